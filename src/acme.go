@@ -0,0 +1,141 @@
+package dnscli
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// challengeAttempts bounds how many times a challenge value lost to a
+// concurrent hook writing the same RRset is set again.
+const challengeAttempts = 3
+
+func containsData(datas []string, value string) bool {
+	for _, v := range datas {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// challengeName returns the challenge record of the certificate domain.
+func challengeName(domain string) string {
+	return "_acme-challenge." + fqdn(strings.TrimPrefix(domain, "*."))
+}
+
+// challengeArgs returns the challenge record and TXT value of a hook call:
+// `<fqdn> <value>` from the lego exec provider or the command line, `--
+// <domain> <token> <keyAuth>` from lego in RAW mode, or nothing with the
+// CERTBOT_DOMAIN and CERTBOT_VALIDATION variables of certbot.
+func challengeArgs(args []string) (string, string, bool) {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	switch len(args) {
+	case 0:
+		domain, value := os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION")
+		if domain == "" || value == "" {
+			return "", "", false
+		}
+		return challengeName(domain), value, true
+	case 2:
+		return fqdn(args[0]), args[1], true
+	case 3:
+		sum := sha256.Sum256([]byte(args[2]))
+		return challengeName(args[0]), base64.RawURLEncoding.EncodeToString(sum[:]), true
+	}
+	return "", "", false
+}
+
+// setChallenge adds value to, or removes it from, the TXT RRset of name and
+// leaves the values of other challenges alone.
+func setChallenge(p DNSProvider, zone, name, value string, present bool) (*RecordChanges, error) {
+	current, err := listRRset(p, zone, name, "TXT")
+	if err != nil {
+		return nil, err
+	}
+	if containsData(current, value) == present {
+		return &RecordChanges{}, nil
+	}
+	datas := make([]string, 0, len(current)+1)
+	for _, v := range current {
+		if v != value {
+			datas = append(datas, v)
+		}
+	}
+	if present {
+		datas = append(datas, value)
+	} else if len(datas) == 0 {
+		return p.Absent(zone, name, "TXT")
+	}
+	return presentRRset(p, zone, DNSRecord{Name: name, Type: "TXT", TTL: 60, Datas: datas})
+}
+
+// AcmeHook runs `dns acme present|cleanup`, the DNS-01 hook of certbot and
+// of the lego exec provider. present returns once every authoritative
+// nameserver serves the value.
+func (s *Cli) AcmeHook(args []string) {
+	if len(args) == 0 || (args[0] != "present" && args[0] != "cleanup") {
+		fmt.Println("Please input present or cleanup.")
+		os.Exit(1)
+	}
+	present := args[0] == "present"
+	name, value, ok := challengeArgs(args[1:])
+	if !ok {
+		fmt.Println("Please input fqdn and value, or set CERTBOT_DOMAIN and CERTBOT_VALIDATION.")
+		os.Exit(1)
+	}
+	domain := s.findDomain(name)
+	if domain == "" {
+		fmt.Println("Domain not found")
+		os.Exit(1)
+	}
+	provider := s.initProvider(domain)
+	s.openAudit()
+	for i := 0; ; i++ {
+		start := time.Now()
+		changes, err := setChallenge(provider, domain, name, value, present)
+		s.auditCommand(domain, start, changes, err)
+		replicas, err := replicaErrors(err)
+		if err != nil {
+			fmt.Printf("Set challenge error, %s.\n", err.Error())
+			os.Exit(1)
+		}
+		if len(changes.Add)+len(changes.Delete) > 0 {
+			printChanges(*changes)
+		}
+		// The primary serves the value, waiting tells whether that is enough.
+		printReplicaErrors(replicas)
+		if !present {
+			fmt.Printf("Cleanup success.\n")
+			return
+		}
+		current, err := listRRset(provider, domain, name, "TXT")
+		if err == nil && containsData(current, value) {
+			break
+		}
+		if i+1 >= challengeAttempts {
+			fmt.Printf("Challenge value of %s lost to a concurrent change.\n", name)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Present success, waiting for the nameservers of %s.\n", defqdn(domain))
+	timeout := time.Duration(s.Config.PropagationTimeout) * time.Second
+	statuses, err := waitNameservers(domain, name, dns.TypeTXT, func(datas []string) bool {
+		return containsData(datas, value)
+	}, timeout)
+	if statuses != nil {
+		printNameservers(statuses)
+	}
+	if err != nil {
+		fmt.Printf("Wait error, %s.\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Served by every nameserver.\n")
+}
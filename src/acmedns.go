@@ -0,0 +1,328 @@
+package dnscli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// acmeTXT matches the value of a DNS-01 challenge, a base64url SHA-256.
+var acmeTXT = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// acmeAccount is an acme-dns registration. Name is the TXT record it
+// updates, its subdomain of AcmeDNSDomain, which clients CNAME to.
+type acmeAccount struct {
+	Username     string
+	PasswordHash string
+	Subdomain    string
+	Name         string
+	AllowFrom    []string
+}
+
+// acmeStore keeps the accounts in a JSON file.
+type acmeStore struct {
+	path     string
+	lock     sync.Mutex
+	accounts map[string]*acmeAccount
+}
+
+func loadAcmeStore(path string) (*acmeStore, error) {
+	s := &acmeStore{path: path, accounts: make(map[string]*acmeAccount)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	accounts := make([]*acmeAccount, 0)
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("parse %s error, %s", path, err)
+	}
+	for _, v := range accounts {
+		s.accounts[v.Username] = v
+	}
+	return s, nil
+}
+
+func (s *acmeStore) get(username string) (*acmeAccount, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	account, ok := s.accounts[username]
+	return account, ok
+}
+
+// add saves account, the file is replaced so it is never half written.
+func (s *acmeStore) add(account *acmeAccount) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	accounts := make([]*acmeAccount, 0, len(s.accounts)+1)
+	for _, v := range s.accounts {
+		accounts = append(accounts, v)
+	}
+	accounts = append(accounts, account)
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.accounts[account.Username] = account
+	return nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b)[:n], nil
+}
+
+// randomUUID returns a version 4 UUID, the format acme-dns uses for users
+// and subdomains.
+func randomUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// hashPassword returns the bcrypt hash of password, as acme-dns stores it.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// ipAllowed tells whether the address of r is in one of cidrs, no cidrs
+// allow everyone.
+func ipAllowed(r *http.Request, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, v := range cidrs {
+		if _, network, err := net.ParseCIDR(v); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type acmeRegisterRequest struct {
+	AllowFrom []string `json:"allowfrom"`
+}
+
+type acmeRegisterResponse struct {
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	FullDomain string   `json:"fulldomain"`
+	Subdomain  string   `json:"subdomain"`
+	AllowFrom  []string `json:"allowfrom"`
+}
+
+type acmeUpdateRequest struct {
+	Subdomain string `json:"subdomain,omitempty"`
+	TXT       string `json:"txt"`
+}
+
+type acmeError struct {
+	Error string `json:"error"`
+}
+
+func (s *Cli) acmeRegister(w http.ResponseWriter, r *http.Request, store *acmeStore) {
+	if !ipAllowed(r, s.Config.AcmeDNSRegisterFrom) {
+		writeJSON(w, http.StatusUnauthorized, acmeError{"forbidden"})
+		return
+	}
+	req := acmeRegisterRequest{}
+	if body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<16)); err != nil {
+		writeJSON(w, http.StatusBadRequest, acmeError{"malformed_json_payload"})
+		return
+	} else if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeJSON(w, http.StatusBadRequest, acmeError{"malformed_json_payload"})
+			return
+		}
+	}
+	for _, v := range req.AllowFrom {
+		if _, _, err := net.ParseCIDR(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, acmeError{"invalid_allowfrom_cidr"})
+			return
+		}
+	}
+	subdomain, err := randomUUID()
+	username, err2 := randomUUID()
+	password, err3 := randomString(40)
+	var hash string
+	if err == nil && err2 == nil && err3 == nil {
+		hash, err = hashPassword(password)
+	}
+	if err != nil || err2 != nil || err3 != nil {
+		writeJSON(w, http.StatusInternalServerError, acmeError{"error"})
+		return
+	}
+	account := &acmeAccount{
+		Username:     username,
+		PasswordHash: hash,
+		Subdomain:    subdomain,
+		AllowFrom:    req.AllowFrom,
+	}
+	if s.Config.AcmeDNSDomain != "" {
+		account.Name = subdomain + "." + fqdn(s.Config.AcmeDNSDomain)
+	}
+	if account.Name == "" || s.findDomain(account.Name) == "" {
+		writeJSON(w, http.StatusBadRequest, acmeError{"domain_not_served"})
+		return
+	}
+	if err := store.add(account); err != nil {
+		log.Printf("Save acme-dns account error, %s", err)
+		writeJSON(w, http.StatusInternalServerError, acmeError{"error"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, acmeRegisterResponse{
+		Username:   username,
+		Password:   password,
+		FullDomain: defqdn(account.Name),
+		Subdomain:  subdomain,
+		AllowFrom:  append([]string{}, req.AllowFrom...),
+	})
+}
+
+// acmePresent sets value in the TXT RRset of name. The previous value is
+// kept when the provider can hold both, as a certificate for a domain and
+// its wildcard validates two values at once.
+func (s *Cli) acmePresent(name, value string) (*RecordChanges, error) {
+	zone := s.findDomain(name)
+	if zone == "" {
+		return nil, errors.New("domain not found")
+	}
+	p := s.dnsProviders[zone]
+	datas := []string{value}
+	if _, ok := p.(RRsetProvider); ok {
+		records, err := p.List(zone)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range groupRRsets(records) {
+			if sameRRset(v, DNSRecord{Name: name, Type: "TXT"}) && len(v.Datas) > 0 && v.Datas[len(v.Datas)-1] != value {
+				datas = []string{v.Datas[len(v.Datas)-1], value}
+			}
+		}
+	}
+	return presentRRset(p, zone, DNSRecord{Name: name, Type: "TXT", TTL: 60, Datas: datas})
+}
+
+func (s *Cli) acmeUpdate(w http.ResponseWriter, r *http.Request, store *acmeStore) {
+	account, ok := store.get(r.Header.Get("X-Api-User"))
+	if !ok || bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(r.Header.Get("X-Api-Key"))) != nil ||
+		!ipAllowed(r, account.AllowFrom) {
+		writeJSON(w, http.StatusUnauthorized, acmeError{"forbidden"})
+		return
+	}
+	req := acmeUpdateRequest{}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<16))
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, acmeError{"malformed_json_payload"})
+		return
+	}
+	if req.Subdomain != account.Subdomain {
+		writeJSON(w, http.StatusUnauthorized, acmeError{"forbidden"})
+		return
+	}
+	if !acmeTXT.MatchString(req.TXT) {
+		writeJSON(w, http.StatusBadRequest, acmeError{"bad_txt"})
+		return
+	}
+	s.updateLock.Lock()
+	defer s.updateLock.Unlock()
+	start := time.Now()
+	changes, err := s.acmePresent(account.Name, req.TXT)
+	if s.audit != nil {
+		entry := s.auditChange("acme-dns", s.findDomain(account.Name), start, changes, err)
+		entry.Key = account.Username
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			entry.Client = host
+		}
+		s.audit.write(entry)
+	}
+	if err = primaryError(err); err != nil {
+		log.Printf("Update %s error, %s", account.Name, err)
+		writeJSON(w, http.StatusInternalServerError, acmeError{"db_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, acmeUpdateRequest{TXT: req.TXT})
+}
+
+// ServeAcmeDNS runs the acme-dns compatible API of `dns acme-dns`: POST
+// /register, POST /update and GET /health.
+func (s *Cli) ServeAcmeDNS() {
+	for k, v := range s.dnsProviders {
+		if err := v.Init(); err != nil {
+			log.Fatalf("Init provider for %s error, %s", k, err)
+		}
+	}
+	if s.Config.AcmeDNSStorage == "" {
+		log.Fatal("AcmeDNSStorage not set")
+	}
+	store, err := loadAcmeStore(s.Config.AcmeDNSStorage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s.audit, err = openAuditLog(s.Config.AuditLog); err != nil {
+		log.Fatal(err)
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/register" && r.Method == http.MethodPost:
+			s.acmeRegister(w, r, store)
+		case r.URL.Path == "/update" && r.Method == http.MethodPost:
+			s.acmeUpdate(w, r, store)
+		case r.URL.Path == "/health" && r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+		default:
+			writeJSON(w, http.StatusNotFound, acmeError{"not_found"})
+		}
+	}
+	server := &http.Server{
+		Addr:    s.Config.AcmeDNSListen,
+		Handler: http.HandlerFunc(handler),
+	}
+	if s.Config.TLSCert != "" {
+		certs, err := newCertLoader(s.Config.TLSCert, s.Config.TLSKey)
+		if err != nil {
+			log.Fatalf("Load certificate error, %s", err)
+		}
+		server.TLSConfig = certs.tlsConfig()
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,218 @@
+package dnscli
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// APIToken is a bearer token of the REST API, with access to Zones or, when
+// empty, to every domain. Name identifies it in the audit log.
+type APIToken struct {
+	Name  string
+	Token string
+	Zones []string
+}
+
+func (s *APIToken) allowZone(zone string) bool {
+	if len(s.Zones) == 0 {
+		return true
+	}
+	for _, v := range s.Zones {
+		if sameName(v, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+type apiError struct {
+	Error string
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Write API response error, %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, apiError{fmt.Sprintf(format, args...)})
+}
+
+// apiToken returns the token of the Authorization header of r.
+func (s *Cli) apiToken(r *http.Request) *APIToken {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil
+	}
+	given := []byte(strings.TrimPrefix(auth, "Bearer "))
+	for i := range s.Config.APITokens {
+		token := &s.Config.APITokens[i]
+		if token.Token != "" && subtle.ConstantTimeCompare(given, []byte(token.Token)) == 1 {
+			return token
+		}
+	}
+	return nil
+}
+
+// apiName returns the absolute name of a record given in a path, "@" is the
+// zone apex and names without a trailing dot are relative to the zone.
+func apiName(zone, name string) string {
+	if name == "@" {
+		return zone
+	}
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "." + zone
+}
+
+// auditAPI logs a change made through the REST API.
+func (s *Cli) auditAPI(r *http.Request, token *APIToken, zone string, start time.Time, changes *RecordChanges, err error) {
+	if s.audit == nil {
+		return
+	}
+	entry := s.auditChange("api", zone, start, changes, err)
+	entry.Key = token.Name
+	entry.Command = []string{r.Method, r.URL.Path}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.Client = host
+	}
+	s.audit.write(entry)
+}
+
+// serveAPI routes GET /zones, GET /zones/{zone}/records and PUT or DELETE
+// /zones/{zone}/records/{name}/{type}.
+func (s *Cli) serveAPI(w http.ResponseWriter, r *http.Request) {
+	token := s.apiToken(r)
+	if token == nil {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "zones" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		zones := make([]string, 0)
+		for k := range s.dnsProviders {
+			if token.allowZone(k) {
+				zones = append(zones, k)
+			}
+		}
+		sort.Strings(zones)
+		writeJSON(w, http.StatusOK, zones)
+		return
+	}
+	zone := s.findZone(fqdn(parts[1]))
+	if zone == "" || !token.allowZone(zone) {
+		writeError(w, http.StatusNotFound, "zone %s not found", parts[1])
+		return
+	}
+	p := s.dnsProviders[zone]
+	switch {
+	case len(parts) == 3 && parts[2] == "records" && r.Method == http.MethodGet:
+		records, err := p.List(zone)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, "%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, groupRRsets(records))
+	case len(parts) == 5 && parts[2] == "records" && r.Method == http.MethodPut:
+		var record DNSRecord
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err == nil {
+			err = json.Unmarshal(body, &record)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid record, %s", err)
+			return
+		}
+		record.Name, record.Type = apiName(zone, parts[3]), parts[4]
+		if record.TTL == 0 {
+			record.TTL = 300
+		}
+		if record, err = checkRecord(zone, record); err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+		s.updateLock.Lock()
+		defer s.updateLock.Unlock()
+		start := time.Now()
+		changes, err := presentRRset(p, zone, record)
+		s.auditAPI(r, token, zone, start, changes, err)
+		if err = primaryError(err); err != nil {
+			writeError(w, http.StatusBadGateway, "%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, changes)
+	case len(parts) == 5 && parts[2] == "records" && r.Method == http.MethodDelete:
+		name := apiName(zone, parts[3])
+		if !dns.IsSubDomain(zone, fqdn(name)) {
+			writeError(w, http.StatusBadRequest, "record %s not in zone %s", name, zone)
+			return
+		}
+		s.updateLock.Lock()
+		defer s.updateLock.Unlock()
+		start := time.Now()
+		changes, err := p.Absent(zone, fqdn(name), strings.ToUpper(parts[4]))
+		s.auditAPI(r, token, zone, start, changes, err)
+		if err = primaryError(err); err != nil {
+			writeError(w, http.StatusBadGateway, "%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, changes)
+	case len(parts) == 3 || len(parts) == 5:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// ServeAPI runs the REST API of `dns serve-api` on APIListen, over TLS when
+// TLSCert is set.
+func (s *Cli) ServeAPI() {
+	for k, v := range s.dnsProviders {
+		if err := v.Init(); err != nil {
+			log.Fatalf("Init provider for %s error, %s", k, err)
+		}
+	}
+	if len(s.Config.APITokens) == 0 {
+		log.Fatal("no api token configured")
+	}
+	audit, err := openAuditLog(s.Config.AuditLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.audit = audit
+	server := &http.Server{
+		Addr:    s.Config.APIListen,
+		Handler: http.HandlerFunc(s.serveAPI),
+	}
+	if s.Config.TLSCert != "" {
+		certs, err := newCertLoader(s.Config.TLSCert, s.Config.TLSKey)
+		if err != nil {
+			log.Fatalf("Load certificate error, %s", err)
+		}
+		server.TLSConfig = certs.tlsConfig()
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,178 @@
+package dnscli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// auditEntry is one line of the audit log, a change made through the daemon
+// or the command line.
+type auditEntry struct {
+	Time          time.Time
+	Source        string
+	Client        string   `json:",omitempty"`
+	Key           string   `json:",omitempty"`
+	User          string   `json:",omitempty"`
+	Command       []string `json:",omitempty"`
+	Zone          string
+	Provider      string
+	Prerequisites []string `json:",omitempty"`
+	Updates       []string `json:",omitempty"`
+	Changes       *RecordChanges
+	Duration      float64
+	Rcode         string `json:",omitempty"`
+	Error         string `json:",omitempty"`
+	// ReplicaErrors are the replicas which failed to mirror a change the
+	// primary made.
+	ReplicaErrors []string `json:",omitempty"`
+}
+
+// auditLog writes one JSON object per line to a file or to syslog.
+type auditLog struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// openAuditLog opens target, "syslog" or a file path. An empty target logs
+// nothing.
+func openAuditLog(target string) (*auditLog, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if target == "syslog" {
+		w, err := openSyslog()
+		if err != nil {
+			return nil, fmt.Errorf("open audit syslog error, %s", err)
+		}
+		return &auditLog{w: w}, nil
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log error, %s", err)
+	}
+	return &auditLog{w: f}, nil
+}
+
+func (s *auditLog) write(entry auditEntry) {
+	if s == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Audit log error, %s", err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		log.Printf("Audit log error, %s", err)
+	}
+}
+
+func (s *auditLog) close() {
+	if s == nil {
+		return
+	}
+	if c, ok := s.w.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// providerName returns the name of the provider entry serving zone.
+func (s *Cli) providerName(zone string) string {
+	for k, v := range s.Config.Domains {
+		if sameName(k, zone) {
+			return v.Provider
+		}
+	}
+	return ""
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	result := make([]string, 0, len(rrs))
+	for _, v := range rrs {
+		result = append(result, v.String())
+	}
+	return result
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// setError records err in entry, a replica failure apart from the error of
+// the primary.
+func (s *auditEntry) setError(err error) {
+	replicas, err := replicaErrors(err)
+	s.Error = errString(err)
+	s.ReplicaErrors = replicas
+}
+
+// auditUpdate logs an UPDATE received by the daemon, whatever its outcome.
+func (s *Cli) auditUpdate(w dns.ResponseWriter, r *dns.Msg, start time.Time, changes *RecordChanges, err error, rcode int) {
+	if s.audit == nil {
+		return
+	}
+	entry := auditEntry{
+		Time:          start,
+		Source:        "daemon",
+		Prerequisites: rrStrings(r.Answer),
+		Updates:       rrStrings(r.Ns),
+		Changes:       changes,
+		Duration:      time.Since(start).Seconds(),
+		Rcode:         dns.RcodeToString[rcode],
+	}
+	entry.setError(err)
+	if host, _, err := net.SplitHostPort(w.RemoteAddr().String()); err == nil {
+		entry.Client = host
+	}
+	if t := r.IsTsig(); t != nil {
+		entry.Key = strings.ToLower(t.Hdr.Name)
+	}
+	if len(r.Question) == 1 {
+		entry.Zone = r.Question[0].Name
+		entry.Provider = s.providerName(entry.Zone)
+	}
+	s.audit.write(entry)
+}
+
+// auditChange fills the entry of a change made to zone from source since
+// start, callers add who made it.
+func (s *Cli) auditChange(source, zone string, start time.Time, changes *RecordChanges, err error) auditEntry {
+	entry := auditEntry{
+		Time:     start,
+		Source:   source,
+		Zone:     zone,
+		Provider: s.providerName(zone),
+		Changes:  changes,
+		Duration: time.Since(start).Seconds(),
+	}
+	entry.setError(err)
+	return entry
+}
+
+// auditCommand logs a change made from the command line.
+func (s *Cli) auditCommand(zone string, start time.Time, changes *RecordChanges, err error) {
+	if s.audit == nil {
+		return
+	}
+	entry := s.auditChange("cli", zone, start, changes, err)
+	entry.Command = os.Args[1:]
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	s.audit.write(entry)
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package dnscli
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog() (io.Writer, error) {
+	return nil, errors.New("syslog is not supported on this system")
+}
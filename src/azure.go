@@ -0,0 +1,313 @@
+package dnscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	AzureManagementURL = "https://management.azure.com"
+	AzureAuthorityURL  = "https://login.microsoftonline.com"
+	azureAPIVersion    = "2018-05-01"
+)
+
+type azureRecordSet struct {
+	Name       string             `json:"name,omitempty"`
+	Type       string             `json:"type,omitempty"`
+	Properties azureRecordSetProp `json:"properties"`
+}
+
+type azureRecordSetProp struct {
+	TTL         int               `json:"TTL"`
+	ARecords    []azureARecord    `json:"ARecords,omitempty"`
+	AAAARecords []azureAAAARecord `json:"AAAARecords,omitempty"`
+	CNAMERecord *azureCNAMERecord `json:"CNAMERecord,omitempty"`
+	MXRecords   []azureMXRecord   `json:"MXRecords,omitempty"`
+	NSRecords   []azureNSRecord   `json:"NSRecords,omitempty"`
+	PTRRecords  []azurePTRRecord  `json:"PTRRecords,omitempty"`
+	SRVRecords  []azureSRVRecord  `json:"SRVRecords,omitempty"`
+	TXTRecords  []azureTXTRecord  `json:"TXTRecords,omitempty"`
+	CAARecords  []azureCAARecord  `json:"caaRecords,omitempty"`
+	SOARecord   *azureSOARecord   `json:"SOARecord,omitempty"`
+}
+
+type azureARecord struct {
+	IPv4Address string `json:"ipv4Address"`
+}
+
+type azureAAAARecord struct {
+	IPv6Address string `json:"ipv6Address"`
+}
+
+type azureCNAMERecord struct {
+	Cname string `json:"cname"`
+}
+
+type azureMXRecord struct {
+	Preference int    `json:"preference"`
+	Exchange   string `json:"exchange"`
+}
+
+type azureNSRecord struct {
+	Nsdname string `json:"nsdname"`
+}
+
+type azurePTRRecord struct {
+	Ptrdname string `json:"ptrdname"`
+}
+
+type azureSRVRecord struct {
+	Priority int    `json:"priority"`
+	Weight   int    `json:"weight"`
+	Port     int    `json:"port"`
+	Target   string `json:"target"`
+}
+
+type azureTXTRecord struct {
+	Value []string `json:"value"`
+}
+
+type azureCAARecord struct {
+	Flags int    `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+type azureSOARecord struct {
+	Host         string `json:"host"`
+	Email        string `json:"email"`
+	SerialNumber int64  `json:"serialNumber"`
+	RefreshTime  int64  `json:"refreshTime"`
+	RetryTime    int64  `json:"retryTime"`
+	ExpireTime   int64  `json:"expireTime"`
+	MinimumTTL   int64  `json:"minimumTTL"`
+}
+
+type AzureProvider struct {
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+	SubscriptionID string
+	ResourceGroup  string
+	Endpoint       string
+	AuthorityHost  string
+	client         *restClient
+}
+
+func (s *AzureProvider) zonePath(Domain string) string {
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/dnsZones/%s",
+		url.PathEscape(s.SubscriptionID), url.PathEscape(s.ResourceGroup), url.PathEscape(defqdn(Domain)))
+}
+
+func (s *AzureProvider) recordSetPath(Domain, Record, Type string) string {
+	return fmt.Sprintf("%s/%s/%s?api-version=%s", s.zonePath(Domain), url.PathEscape(strings.ToUpper(Type)),
+		url.PathEscape(subName(Domain, Record, "@")), azureAPIVersion)
+}
+
+func (s *AzureProvider) toRecord(Domain string, v azureRecordSet) DNSRecord {
+	t := v.Type[strings.LastIndex(v.Type, "/")+1:]
+	p := v.Properties
+	record := DNSRecord{absName(Domain, v.Name, "@"), t, p.TTL, make([]string, 0)}
+	for _, r := range p.ARecords {
+		record.Datas = append(record.Datas, r.IPv4Address)
+	}
+	for _, r := range p.AAAARecords {
+		record.Datas = append(record.Datas, r.IPv6Address)
+	}
+	if p.CNAMERecord != nil {
+		record.Datas = append(record.Datas, p.CNAMERecord.Cname)
+	}
+	for _, r := range p.MXRecords {
+		record.Datas = append(record.Datas, fmt.Sprintf("%d %s", r.Preference, r.Exchange))
+	}
+	for _, r := range p.NSRecords {
+		record.Datas = append(record.Datas, r.Nsdname)
+	}
+	for _, r := range p.PTRRecords {
+		record.Datas = append(record.Datas, r.Ptrdname)
+	}
+	for _, r := range p.SRVRecords {
+		record.Datas = append(record.Datas, fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Target))
+	}
+	for _, r := range p.TXTRecords {
+		record.Datas = append(record.Datas, strings.Join(r.Value, ""))
+	}
+	for _, r := range p.CAARecords {
+		// Let dns quote the value, it may hold spaces or semicolons.
+		caa := &dns.CAA{Hdr: dns.RR_Header{Rrtype: dns.TypeCAA}, Flag: uint8(r.Flags), Tag: r.Tag, Value: r.Value}
+		record.Datas = append(record.Datas, rr2Record(caa).Datas[0])
+	}
+	if r := p.SOARecord; r != nil {
+		record.Datas = append(record.Datas, fmt.Sprintf("%s %s %d %d %d %d %d",
+			r.Host, r.Email, r.SerialNumber, r.RefreshTime, r.RetryTime, r.ExpireTime, r.MinimumTTL))
+	}
+	return record
+}
+
+func (s *AzureProvider) fromRecord(record DNSRecord) (*azureRecordSet, error) {
+	rrs, err := DNSRecord2RR(record)
+	if err != nil {
+		return nil, err
+	}
+	p := azureRecordSetProp{TTL: record.TTL}
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.A:
+			p.ARecords = append(p.ARecords, azureARecord{v.A.String()})
+		case *dns.AAAA:
+			p.AAAARecords = append(p.AAAARecords, azureAAAARecord{v.AAAA.String()})
+		case *dns.CNAME:
+			if p.CNAMERecord != nil {
+				return nil, errors.New("azure: only one CNAME value allowed")
+			}
+			p.CNAMERecord = &azureCNAMERecord{v.Target}
+		case *dns.MX:
+			p.MXRecords = append(p.MXRecords, azureMXRecord{int(v.Preference), v.Mx})
+		case *dns.NS:
+			p.NSRecords = append(p.NSRecords, azureNSRecord{v.Ns})
+		case *dns.PTR:
+			p.PTRRecords = append(p.PTRRecords, azurePTRRecord{v.Ptr})
+		case *dns.SRV:
+			p.SRVRecords = append(p.SRVRecords, azureSRVRecord{int(v.Priority), int(v.Weight), int(v.Port), v.Target})
+		case *dns.TXT:
+			p.TXTRecords = append(p.TXTRecords, azureTXTRecord{v.Txt})
+		case *dns.CAA:
+			p.CAARecords = append(p.CAARecords, azureCAARecord{int(v.Flag), v.Tag, v.Value})
+		default:
+			return nil, fmt.Errorf("azure: record type %s not supported", record.Type)
+		}
+	}
+	return &azureRecordSet{Properties: p}, nil
+}
+
+func (s *AzureProvider) List(Domain string) ([]DNSRecord, error) {
+	result := make([]DNSRecord, 0)
+	next := fmt.Sprintf("%s/all?api-version=%s", s.zonePath(Domain), azureAPIVersion)
+	for next != "" {
+		var rsp struct {
+			Value    []azureRecordSet `json:"value"`
+			NextLink string           `json:"nextLink"`
+		}
+		if _, err := s.client.do("GET", next, nil, &rsp); err != nil {
+			return nil, err
+		}
+		for _, v := range rsp.Value {
+			result = append(result, s.toRecord(Domain, v))
+		}
+		next = rsp.NextLink
+	}
+	return result, nil
+}
+
+func (s *AzureProvider) get(Domain, Record, Type string) (*DNSRecord, error) {
+	rsp := azureRecordSet{}
+	if _, err := s.client.do("GET", s.recordSetPath(Domain, Record, Type), nil, &rsp); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	record := s.toRecord(Domain, rsp)
+	return &record, nil
+}
+
+func (s *AzureProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *AzureProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.fromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.get(Domain, record.Name, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	// PUT replaces the whole record set, there is no need to delete it first.
+	if _, err := s.client.do("PUT", s.recordSetPath(Domain, record.Name, record.Type), body, nil); err != nil {
+		return nil, err
+	}
+	recordChanges := &RecordChanges{Add: []DNSRecord{record}}
+	if old != nil {
+		recordChanges.Delete = []DNSRecord{*old}
+	}
+	return recordChanges, nil
+}
+
+func (s *AzureProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	old, err := s.get(Domain, Record, Type)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return nil, errors.New("records not found")
+	}
+	if _, err := s.client.do("DELETE", s.recordSetPath(Domain, Record, Type), nil, nil); err != nil {
+		return nil, err
+	}
+	return &RecordChanges{Delete: []DNSRecord{*old}}, nil
+}
+
+func (s *AzureProvider) Init() error {
+	if s.client != nil {
+		return nil
+	}
+	conf := clientcredentials.Config{
+		ClientID:     s.ClientID,
+		ClientSecret: s.ClientSecret,
+		TokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimRight(s.AuthorityHost, "/"), url.PathEscape(s.TenantID)),
+		Scopes:       []string{AzureManagementURL + "/.default"},
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: 30 * time.Second})
+	client := newRestClient(s.Endpoint, nil)
+	client.client = conf.Client(ctx)
+	client.client.Timeout = 30 * time.Second
+	s.client = client
+	return nil
+}
+
+func init() {
+	RegisterProvider("Azure", NewAzureProvider, "TenantID", "ClientID", "ClientSecret", "SubscriptionID", "ResourceGroup")
+}
+
+func NewAzureProvider(info map[string]string) (DNSProvider, error) {
+	p := &AzureProvider{
+		Endpoint:      AzureManagementURL,
+		AuthorityHost: AzureAuthorityURL,
+	}
+	required := map[string]*string{
+		"TenantID":       &p.TenantID,
+		"ClientID":       &p.ClientID,
+		"ClientSecret":   &p.ClientSecret,
+		"SubscriptionID": &p.SubscriptionID,
+		"ResourceGroup":  &p.ResourceGroup,
+	}
+	for k, v := range required {
+		if value, ok := info[k]; ok && value != "" {
+			*v = value
+		} else {
+			return nil, fmt.Errorf("azure: %s not found", k)
+		}
+	}
+	if v, ok := info["Endpoint"]; ok && v != "" {
+		p.Endpoint = v
+	}
+	if v, ok := info["AuthorityHost"]; ok && v != "" {
+		p.AuthorityHost = v
+	}
+	return p, nil
+}
@@ -0,0 +1,118 @@
+package dnscli
+
+import "testing"
+
+const azureZone = "/subscriptions/SUB/resourceGroups/RG/providers/Microsoft.Network/dnsZones/example.com"
+
+var azureToken = fixture{
+	Method: "POST", URI: "/TENANT/oauth2/v2.0/token",
+	Body: `{"access_token":"AT","token_type":"Bearer","expires_in":3600}`,
+}
+
+func azureProvider(t *testing.T, fixtures []fixture) DNSProvider {
+	return fixtureProviderInfo(t, map[string]string{
+		"Type":           "Azure",
+		"TenantID":       "TENANT",
+		"ClientID":       "CLIENT",
+		"ClientSecret":   "SECRET",
+		"SubscriptionID": "SUB",
+		"ResourceGroup":  "RG",
+		"AuthorityHost":  "{{server}}",
+	}, append([]fixture{azureToken}, fixtures...))
+}
+
+func TestAzureList(t *testing.T) {
+	p := azureProvider(t, []fixture{
+		{
+			Method: "GET", URI: azureZone + "/all?api-version=2018-05-01",
+			Body: `{"value":[
+				{"name":"@","type":"Microsoft.Network/dnszones/MX","properties":{"TTL":300,
+					"MXRecords":[{"preference":10,"exchange":"mx.example.com."}]}},
+				{"name":"www","type":"Microsoft.Network/dnszones/A","properties":{"TTL":60,
+					"ARecords":[{"ipv4Address":"192.0.2.1"},{"ipv4Address":"192.0.2.2"}]}}
+			],"nextLink":"{{server}}` + azureZone + `/all?api-version=2018-05-01&$skipToken=T2"}`,
+		},
+		{
+			Method: "GET", URI: azureZone + "/all?api-version=2018-05-01&$skipToken=T2",
+			Body: `{"value":[
+				{"name":"www","type":"Microsoft.Network/dnszones/TXT","properties":{"TTL":60,
+					"TXTRecords":[{"value":["hello ","world"]}]}},
+				{"name":"@","type":"Microsoft.Network/dnszones/CAA","properties":{"TTL":3600,
+					"caaRecords":[{"flags":0,"tag":"iodef","value":"mailto:ca@example.com; policy"}]}}
+			]}`,
+		},
+	})
+	records, err := p.List("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "records", records, []DNSRecord{
+		{"example.com.", "MX", 300, []string{"10 mx.example.com."}},
+		{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2"}},
+		{"www.example.com.", "TXT", 60, []string{"hello world"}},
+		{"example.com.", "CAA", 3600, []string{`0 iodef "mailto:ca@example.com; policy"`}},
+	})
+}
+
+func TestAzurePresent(t *testing.T) {
+	p := azureProvider(t, []fixture{
+		{
+			Method: "GET", URI: azureZone + "/CAA/@?api-version=2018-05-01",
+			Status: 404,
+			Body:   `{"code":"NotFound","message":"The resource record '@' does not exist."}`,
+		},
+		{
+			Method: "PUT", URI: azureZone + "/CAA/@?api-version=2018-05-01",
+			Request: `{"properties":{"TTL":3600,"caaRecords":[{"flags":0,"tag":"issue","value":"ca.example.net; account=1"}]}}`,
+			Status:  201,
+			Body:    `{}`,
+		},
+		{
+			Method: "GET", URI: azureZone + "/A/www?api-version=2018-05-01",
+			Body: `{"name":"www","type":"Microsoft.Network/dnszones/A","properties":{"TTL":60,
+				"ARecords":[{"ipv4Address":"192.0.2.1"}]}}`,
+		},
+		{
+			Method: "PUT", URI: azureZone + "/A/www?api-version=2018-05-01",
+			Request: `{"properties":{"TTL":300,"ARecords":[{"ipv4Address":"192.0.2.9"}]}}`,
+			Body:    `{}`,
+		},
+	})
+	caa := `0 issue "ca.example.net; account=1"`
+	changes, err := p.Present("example.com.", "example.com.", "CAA", caa, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"example.com.", "CAA", 3600, []string{caa}}})
+	checkRRsets(t, "deleted", changes.Delete, nil)
+	changes, err = p.Present("example.com.", "www.example.com.", "A", "192.0.2.9", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.9"}}})
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.1"}}})
+}
+
+func TestAzureAbsent(t *testing.T) {
+	p := azureProvider(t, []fixture{
+		{
+			Method: "GET", URI: azureZone + "/TXT/www?api-version=2018-05-01",
+			Body: `{"name":"www","type":"Microsoft.Network/dnszones/TXT","properties":{"TTL":60,
+				"TXTRecords":[{"value":["hello"]}]}}`,
+		},
+		{Method: "DELETE", URI: azureZone + "/TXT/www?api-version=2018-05-01"},
+		{
+			Method: "GET", URI: azureZone + "/TXT/www?api-version=2018-05-01",
+			Status: 404,
+			Body:   `{"code":"NotFound","message":"The resource record 'www' does not exist."}`,
+		},
+	})
+	changes, err := p.Absent("example.com.", "www.example.com.", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "TXT", 60, []string{"hello"}}})
+	if _, err := p.Absent("example.com.", "www.example.com.", "TXT"); err == nil {
+		t.Error("absent of a missing RRset did not fail")
+	}
+}
@@ -0,0 +1,147 @@
+package dnscli
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheStatsInterval is how often the daemon logs the cache hit rate.
+const cacheStatsInterval = 10 * time.Minute
+
+type cacheEntry struct {
+	lock    sync.Mutex
+	records []DNSRecord
+	expires time.Time
+}
+
+// zoneCache keeps the List result of every zone for ttl, so queries do not
+// each list the zone from the provider. A zero ttl disables it.
+type zoneCache struct {
+	// hits and misses come first to stay 64 bit aligned for atomic.
+	hits    uint64
+	misses  uint64
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+	stop    chan struct{}
+}
+
+func newZoneCache(ttl time.Duration) *zoneCache {
+	return &zoneCache{ttl: ttl, stop: make(chan struct{})}
+}
+
+// start runs the background refresher of providers, when refresh is set, and
+// the hit rate logger until close.
+func (s *zoneCache) start(providers map[string]DNSProvider, refresh time.Duration) {
+	if s.ttl <= 0 {
+		return
+	}
+	if refresh > 0 {
+		go s.refresh(providers, refresh)
+	}
+	go s.logStats()
+}
+
+func (s *zoneCache) close() {
+	close(s.stop)
+}
+
+func (s *zoneCache) entry(zone string) *cacheEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]*cacheEntry)
+	}
+	e, ok := s.entries[zone]
+	if !ok {
+		e = &cacheEntry{}
+		s.entries[zone] = e
+	}
+	return e
+}
+
+// list returns the records of zone, from the cache while they are fresh.
+// Concurrent misses on a zone share one List call. The result must not be
+// modified.
+func (s *zoneCache) list(zone string, p DNSProvider) ([]DNSRecord, error) {
+	if s.ttl <= 0 {
+		return p.List(zone)
+	}
+	e := s.entry(zone)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.records != nil && time.Now().Before(e.expires) {
+		atomic.AddUint64(&s.hits, 1)
+		return e.records, nil
+	}
+	atomic.AddUint64(&s.misses, 1)
+	return e.fill(zone, p, s.ttl)
+}
+
+func (s *cacheEntry) fill(zone string, p DNSProvider, ttl time.Duration) ([]DNSRecord, error) {
+	records, err := p.List(zone)
+	if err != nil {
+		return nil, err
+	}
+	s.records, s.expires = records, time.Now().Add(ttl)
+	return records, nil
+}
+
+// invalidate drops zone, the next list reads it from the provider. A List
+// in progress is waited for, so its result does not outlive the change.
+func (s *zoneCache) invalidate(zone string) {
+	if s.ttl <= 0 {
+		return
+	}
+	e := s.entry(zone)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.records = nil
+}
+
+// refresh lists every zone of providers again every interval. A failed List
+// keeps the cached records until they expire.
+func (s *zoneCache) refresh(providers map[string]DNSProvider, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		for zone, p := range providers {
+			e := s.entry(zone)
+			e.lock.Lock()
+			if _, err := e.fill(zone, p, s.ttl); err != nil {
+				log.Printf("Refresh cache of %s failed, %s", zone, err)
+			}
+			e.lock.Unlock()
+		}
+	}
+}
+
+// stats returns the number of cache hits and misses so far.
+func (s *zoneCache) stats() (hits, misses uint64) {
+	return atomic.LoadUint64(&s.hits), atomic.LoadUint64(&s.misses)
+}
+
+func (s *zoneCache) logStats() {
+	ticker := time.NewTicker(cacheStatsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		hits, misses := s.stats()
+		rate := 0.0
+		if hits+misses > 0 {
+			rate = float64(hits) * 100 / float64(hits+misses)
+		}
+		log.Printf("Cache hits %d, misses %d, hit rate %.1f%%", hits, misses, rate)
+	}
+}
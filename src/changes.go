@@ -0,0 +1,121 @@
+package dnscli
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// ChangeApplier is implemented by providers able to apply several RRset
+// changes at once, either all of them succeed or none does.
+//
+// changes.Delete holds the current content of every RRset removed or
+// replaced, changes.Add the new content of every RRset created or replaced.
+type ChangeApplier interface {
+	ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error)
+}
+
+func rrsetKey(record DNSRecord) string {
+	return strings.ToLower(fqdn(record.Name)) + " " + strings.ToUpper(record.Type)
+}
+
+func sameDatas(l, r []string) bool {
+	if len(l) != len(r) {
+		return false
+	}
+	ls := append([]string{}, l...)
+	rs := append([]string{}, r...)
+	sort.Strings(ls)
+	sort.Strings(rs)
+	for i := range ls {
+		if ls[i] != rs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffRRsets returns the RRset level changes turning before into after.
+func diffRRsets(before, after []DNSRecord) RecordChanges {
+	changes := RecordChanges{}
+	old := make(map[string]DNSRecord)
+	for _, v := range before {
+		old[rrsetKey(v)] = v
+	}
+	seen := make(map[string]bool)
+	for _, v := range after {
+		key := rrsetKey(v)
+		seen[key] = true
+		if o, ok := old[key]; ok {
+			if o.TTL == v.TTL && sameDatas(o.Datas, v.Datas) {
+				continue
+			}
+			changes.Delete = append(changes.Delete, o)
+		}
+		changes.Add = append(changes.Add, v)
+	}
+	for _, v := range before {
+		if !seen[rrsetKey(v)] {
+			changes.Delete = append(changes.Delete, v)
+		}
+	}
+	return changes
+}
+
+// applyChanges applies changes through ApplyChanges when the provider
+// supports it. Otherwise RRsets are changed one by one, and the ones already
+// changed are restored when a later one fails.
+func applyChanges(p DNSProvider, Domain string, changes RecordChanges) (*RecordChanges, error) {
+	if v, ok := p.(ChangeApplier); ok {
+		return v.ApplyChanges(Domain, changes)
+	}
+	old := make(map[string]DNSRecord)
+	for _, v := range changes.Delete {
+		old[rrsetKey(v)] = v
+	}
+	result := &RecordChanges{}
+	done := make([]string, 0)
+	current := make(map[string]DNSRecord)
+	var err error
+	for _, v := range changes.Add {
+		var c *RecordChanges
+		// The RRset is rolled back even when presenting it failed, as it
+		// may have been partly applied.
+		done = append(done, rrsetKey(v))
+		current[rrsetKey(v)] = v
+		if c, err = presentRRset(p, Domain, v); err != nil {
+			break
+		}
+		result.Add = append(result.Add, c.Add...)
+		result.Delete = append(result.Delete, c.Delete...)
+	}
+	if err == nil {
+		for _, v := range changes.Delete {
+			if _, ok := current[rrsetKey(v)]; ok {
+				continue
+			}
+			var c *RecordChanges
+			done = append(done, rrsetKey(v))
+			if c, err = p.Absent(Domain, fqdn(v.Name), v.Type); err != nil {
+				break
+			}
+			result.Delete = append(result.Delete, c.Delete...)
+		}
+	}
+	if err == nil {
+		return result, nil
+	}
+	for i := len(done) - 1; i >= 0; i-- {
+		var rollbackErr error
+		if o, ok := old[done[i]]; ok {
+			_, rollbackErr = presentRRset(p, Domain, o)
+		} else {
+			v := current[done[i]]
+			_, rollbackErr = p.Absent(Domain, fqdn(v.Name), v.Type)
+		}
+		if rollbackErr != nil {
+			log.Printf("Rollback %s in %s failed, %s", done[i], Domain, rollbackErr)
+		}
+	}
+	return nil, err
+}
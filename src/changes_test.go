@@ -0,0 +1,86 @@
+package dnscli
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingProvider changes RRsets one by one and fails call number failAt,
+// after applying it when partial is set.
+type failingProvider struct {
+	*MemoryProvider
+	calls   int
+	failAt  int
+	partial bool
+}
+
+func (s *failingProvider) fail(apply func() (*RecordChanges, error)) (*RecordChanges, error) {
+	s.calls++
+	if s.calls != s.failAt {
+		return apply()
+	}
+	if s.partial {
+		apply()
+	}
+	return nil, errors.New("provider failed")
+}
+
+func (s *failingProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *failingProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	return s.fail(func() (*RecordChanges, error) { return s.MemoryProvider.PresentRRset(Domain, record) })
+}
+
+func (s *failingProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	return s.fail(func() (*RecordChanges, error) { return s.MemoryProvider.Absent(Domain, Record, Type) })
+}
+
+// ApplyChanges hides the one of MemoryProvider, applyChanges must fall back
+// to single RRset calls.
+func (s *failingProvider) ApplyChanges() {}
+
+func TestApplyChangesRollback(t *testing.T) {
+	before := []DNSRecord{
+		{"example.com.", "MX", 3600, []string{"10 mail.example.com."}},
+		{"www.example.com.", "A", 300, []string{"192.0.2.1"}},
+	}
+	after := []DNSRecord{
+		{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2"}},
+		{"www.example.com.", "TXT", 60, []string{"hello world"}},
+	}
+	changes := diffRRsets(before, after)
+	for _, c := range []struct {
+		Name    string
+		FailAt  int
+		Partial bool
+		Want    []DNSRecord
+	}{
+		{"no failure", 0, false, after},
+		{"first change", 1, false, before},
+		{"second change", 2, false, before},
+		{"second change partly applied", 2, true, before},
+		{"delete", 3, false, before},
+		{"delete partly applied", 3, true, before},
+	} {
+		memory := &MemoryProvider{zones: make(map[string][]DNSRecord)}
+		for _, v := range before {
+			if _, err := memory.PresentRRset("example.com.", v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		p := &failingProvider{MemoryProvider: memory, failAt: c.FailAt, partial: c.Partial}
+		if _, ok := DNSProvider(p).(ChangeApplier); ok {
+			t.Fatal("failingProvider is a ChangeApplier")
+		}
+		_, err := applyChanges(p, "example.com.", changes)
+		if (err != nil) != (c.FailAt != 0) {
+			t.Errorf("%s: error %v", c.Name, err)
+		}
+		records, _ := memory.List("example.com.")
+		if !sameRRsets(records, c.Want) {
+			t.Errorf("%s: records %v, want %v", c.Name, sortedRRsets(records), sortedRRsets(c.Want))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package dnscli
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -8,8 +9,11 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/miekg/dns"
+	"github.com/olekukonko/tablewriter"
 )
 
 var _version_ string
@@ -17,45 +21,105 @@ var _version_ string
 type Cli struct {
 	Config
 	dnsProviders map[string]DNSProvider
-	tsigName     string
-	tsigSecret   string
-	tsigAlg      string
+	configPath   string
+	keys         keyring
+	updateLock   sync.Mutex
+	history      zoneHistory
+	cache        *zoneCache
+	publicKey    *TsigKey
+	limiter      *rateLimiter
+	metrics      *metrics
+	audit        *auditLog
+	// wait is set by --wait, changes then return once every authoritative
+	// nameserver serves them.
+	wait bool
+	// reloadLock is held by every request and taken exclusively to switch
+	// to a reloaded config.
+	reloadLock sync.RWMutex
 }
 
 func (s *Cli) Init(path string) *Cli {
+	s.configPath = path
 	s.Config = *(s.Config.Load(path))
 	s.dnsProviders = make(map[string]DNSProvider)
 	return s
 }
 
-func (s *Cli) Load() *Cli {
+// Load builds every configured provider and maps domains to them. All
+// misconfigured entries are reported together.
+func (s *Cli) Load() (*Cli, error) {
 	tmp := make(map[string]DNSProvider)
+	errs := make([]string, 0)
 	for k, v := range s.Config.Providers {
-		if providerType, ok := v["Type"]; ok {
-			switch providerType {
-			case "GoogleCloud":
-				provider := NewGoogleProvider(v)
-				tmp[k] = provider
-			case "Cloudflare":
-				provider := NewCloudflareProvider(v)
-				tmp[k] = provider
-			case "Huawei":
-				provider := NewHuaweiProvider(v)
-				tmp[k] = provider
-			case "Rfc2136":
-				provider := NewRfc2135Provier(v)
-				tmp[k] = provider
-			}
+		provider, err := newProvider(k, v)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
 		}
+		tmp[k] = provider
 	}
 	for k, v := range s.Config.Domains {
 		domainName := dns.Fqdn(k)
-		providerName := v
-		if v, ok := tmp[providerName]; ok {
-			s.dnsProviders[domainName] = v
+		providerName := v.Provider
+		provider, ok := tmp[providerName]
+		if !ok {
+			if _, ok := s.Config.Providers[providerName]; !ok {
+				errs = append(errs, fmt.Sprintf("domain %q: provider %q not found", k, providerName))
+			}
+			continue
+		}
+		if len(v.Replicas) > 0 {
+			replicated := &replicatedProvider{DNSProvider: provider}
+			for _, r := range v.Replicas {
+				if replica, ok := tmp[r]; ok && r != providerName {
+					replicated.names = append(replicated.names, r)
+					replicated.replicas = append(replicated.replicas, replica)
+				} else if r == providerName {
+					errs = append(errs, fmt.Sprintf("domain %q: replica %q is its provider", k, r))
+				} else if _, ok := s.Config.Providers[r]; !ok {
+					errs = append(errs, fmt.Sprintf("domain %q: replica %q not found", k, r))
+				}
+			}
+			provider = replicated
 		}
+		s.dnsProviders[domainName] = provider
 	}
-	return s
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return s, errors.New(strings.Join(errs, "\n"))
+	}
+	return s, nil
+}
+
+func (s *Cli) initProvider(domain string) DNSProvider {
+	provider := s.dnsProviders[domain]
+	if err := provider.Init(); err != nil {
+		fmt.Printf("Init provider error, %s.\n", err.Error())
+		os.Exit(1)
+	}
+	return provider
+}
+
+// openAudit opens the audit log before a change, a change which can not be
+// audited is not made.
+func (s *Cli) openAudit() {
+	audit, err := openAuditLog(s.Config.AuditLog)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(1)
+	}
+	s.audit = audit
+}
+
+func PrintProviders() {
+	fmt.Println("List All Provider Types:")
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Type", "Required Keys"})
+	table.SetAutoWrapText(false)
+	for _, v := range registeredProviders() {
+		table.Append([]string{v.Name, strings.Join(v.Required, ", ")})
+	}
+	table.Render()
 }
 
 func (s *Cli) PrintDomains() {
@@ -80,8 +144,8 @@ func (s *Cli) ListDomain(args []string) {
 	if len(args) >= 2 {
 		typeFilters = args[1:]
 	}
-	if v, ok := s.dnsProviders[domain]; ok {
-		s.dnsProviders[domain].Init()
+	if _, ok := s.dnsProviders[domain]; ok {
+		v := s.initProvider(domain)
 		records, err := v.List(domain)
 		if err != nil {
 			fmt.Printf("List domain err, %s.\n", err.Error())
@@ -103,10 +167,12 @@ func (s *Cli) ListDomain(args []string) {
 	}
 }
 
+// findDomain returns the configured domain holding record, the longest one
+// when domains are nested, or "" when record is in none of them.
 func (s *Cli) findDomain(record string) string {
 	tmpDomain := make([]string, 0)
 	for k := range s.dnsProviders {
-		if strings.Contains(record, k) {
+		if dns.IsSubDomain(k, fqdn(record)) {
 			tmpDomain = append(tmpDomain, k)
 		}
 	}
@@ -128,8 +194,7 @@ func (s *Cli) ShowRecord(args []string) {
 		fmt.Println("Domain not found")
 		os.Exit(1)
 	}
-	s.dnsProviders[domain].Init()
-	records, err := s.dnsProviders[domain].List(domain)
+	records, err := s.initProvider(domain).List(domain)
 	if err != nil {
 		fmt.Printf("List domain err, %s.\n", err.Error())
 		os.Exit(1)
@@ -156,8 +221,7 @@ func (s *Cli) SetRecord(args []string) {
 		fmt.Println("Domain not found")
 		os.Exit(1)
 	}
-	provider := s.dnsProviders[domain]
-	provider.Init()
+	provider := s.initProvider(domain)
 	recordValue := args[1]
 	recordType := ""
 	recordTTL := 300
@@ -185,7 +249,11 @@ func (s *Cli) SetRecord(args []string) {
 			}
 		}
 	}
+	s.openAudit()
+	start := time.Now()
 	changes, err := provider.Present(domain, record, recordType, recordValue, recordTTL)
+	s.auditCommand(domain, start, changes, err)
+	replicas, err := replicaErrors(err)
 	if err != nil {
 		fmt.Printf("Set record error, %s.\n", err.Error())
 		os.Exit(1)
@@ -193,6 +261,13 @@ func (s *Cli) SetRecord(args []string) {
 		fmt.Printf("Set success.\n")
 		printChanges(*changes)
 	}
+	printReplicaErrors(replicas)
+	if s.wait {
+		s.waitRecord(provider, domain, record, recordType)
+	}
+	if len(replicas) > 0 {
+		os.Exit(1)
+	}
 }
 
 func (s *Cli) DeleteRecord(args []string) {
@@ -207,9 +282,12 @@ func (s *Cli) DeleteRecord(args []string) {
 		fmt.Println("Domain not found")
 		os.Exit(1)
 	}
-	provider := s.dnsProviders[domain]
-	provider.Init()
+	provider := s.initProvider(domain)
+	s.openAudit()
+	start := time.Now()
 	changes, err := provider.Absent(domain, record, recordType)
+	s.auditCommand(domain, start, changes, err)
+	replicas, err := replicaErrors(err)
 	if err != nil {
 		fmt.Printf("Delete record error, %s.\n", err.Error())
 		os.Exit(1)
@@ -217,6 +295,43 @@ func (s *Cli) DeleteRecord(args []string) {
 		fmt.Printf("Delete success.\n")
 		printChanges(*changes)
 	}
+	printReplicaErrors(replicas)
+	if s.wait {
+		s.waitRecord(provider, domain, record, recordType)
+	}
+	if len(replicas) > 0 {
+		os.Exit(1)
+	}
+}
+
+// printReplicaErrors reports the replicas which failed to mirror a change.
+func printReplicaErrors(replicas []string) {
+	for _, v := range replicas {
+		fmt.Printf("Replicate error, %s.\n", v)
+	}
+}
+
+func (s *Cli) waitRecord(provider DNSProvider, domain, record, recordType string) {
+	fmt.Printf("Waiting for the nameservers of %s.\n", defqdn(domain))
+	if err := s.checkNameservers(provider, domain, record, recordType); err != nil {
+		fmt.Printf("Wait error, %s.\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Served by every nameserver.\n")
+}
+
+// parseWait removes the --wait option from args.
+func parseWait(args []string) ([]string, bool) {
+	result := make([]string, 0, len(args))
+	wait := false
+	for _, v := range args {
+		if v == "--wait" || v == "-wait" {
+			wait = true
+			continue
+		}
+		result = append(result, v)
+	}
+	return result, wait
 }
 
 func parseOperation(args []string) []string {
@@ -233,7 +348,17 @@ func parseOperation(args []string) []string {
 func Do(configPath string) {
 	args := os.Args[1:]
 	args = parseOperation(args)
-	cli := (&Cli{}).Init(configPath).Load()
+	args, wait := parseWait(args)
+	if len(args) > 0 && args[0] == "providers" {
+		PrintProviders()
+		return
+	}
+	cli, err := (&Cli{}).Init(configPath).Load()
+	if err != nil {
+		fmt.Printf("Load config error:\n%s\n", err.Error())
+		os.Exit(1)
+	}
+	cli.wait = wait
 
 	if len(args) > 0 {
 		switch args[0] {
@@ -263,8 +388,24 @@ func Do(configPath string) {
 			cli.DeleteRecord(args[1:])
 		case "daemon":
 			cli.Listen()
+		case "serve-api":
+			cli.ServeAPI()
+		case "acme-dns":
+			cli.ServeAcmeDNS()
+		case "check":
+			cli.CheckRecord(args[1:])
+		case "replicate-check":
+			cli.ReplicateCheck(args[1:])
+		case "failover":
+			cli.Failover()
+		case "ddns":
+			cli.DDNS(args[1:])
+		case "acme":
+			cli.AcmeHook(args[1:])
+		case "webhook":
+			cli.ServeWebhook()
 		default:
-			fmt.Printf("Command not found. \n Please input domain, list, get, set or delete.")
+			fmt.Printf("Command not found. \n Please input domain, list, get, set, delete or providers.")
 		}
 	}
 }
@@ -1,8 +1,6 @@
 package dnscli
 
 import (
-	"log"
-
 	"github.com/cloudflare/cloudflare-go"
 	"github.com/pkg/errors"
 )
@@ -36,8 +34,17 @@ func (s *CloudflareProvider) List(Domain string) ([]DNSRecord, error) {
 }
 
 func (s *CloudflareProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *CloudflareProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
 	Domain = defqdn(Domain)
-	Record = defqdn(Record)
+	Record := defqdn(record.Name)
+	Type := record.Type
 	id, err := s.client.ZoneIDByName(Domain)
 	if err != nil {
 		return nil, err
@@ -59,19 +66,20 @@ func (s *CloudflareProvider) Present(Domain, Record, Type, Value string, TTL int
 			fqdn(v.Name), v.Type, v.TTL, []string{v.Content},
 		})
 	}
-	_, err = s.client.CreateDNSRecord(id, cloudflare.DNSRecord{
-		ZoneID:  id,
-		Name:    Record,
-		Type:    Type,
-		Content: Value,
-		TTL:     TTL,
-	})
-	if err != nil {
-		return recordChanges, err
+	// Cloudflare keeps one record per value.
+	for _, v := range record.Datas {
+		_, err = s.client.CreateDNSRecord(id, cloudflare.DNSRecord{
+			ZoneID:  id,
+			Name:    Record,
+			Type:    Type,
+			Content: v,
+			TTL:     record.TTL,
+		})
+		if err != nil {
+			return recordChanges, err
+		}
 	}
-	recordChanges.Add = []DNSRecord{{
-		fqdn(Record), Type, TTL, []string{Value},
-	}}
+	recordChanges.Add = []DNSRecord{record}
 	return recordChanges, nil
 }
 
@@ -109,25 +117,30 @@ func (s *CloudflareProvider) Init() error {
 	if s.inited {
 		return nil
 	}
-	if client, err := cloudflare.New(s.key, s.email); err != nil {
-		log.Fatal(err.Error())
-	} else {
-		s.client = client
+	client, err := cloudflare.New(s.key, s.email)
+	if err != nil {
+		return err
 	}
+	s.client = client
+	s.inited = true
 	return nil
 }
 
-func NewCloudflareProvider(info map[string]string) DNSProvider {
+func init() {
+	RegisterProvider("Cloudflare", NewCloudflareProvider, "Email", "Key")
+}
+
+func NewCloudflareProvider(info map[string]string) (DNSProvider, error) {
 	email, ok := info["Email"]
 	if !ok {
-		log.Fatal("Cloudflare email not set.")
+		return nil, errors.New("cloudflare email not set")
 	}
 	key, ok := info["Key"]
 	if !ok {
-		log.Fatal("Cloudflare key not set.")
+		return nil, errors.New("cloudflare key not set")
 	}
 	return &CloudflareProvider{
 		email: email,
 		key:   key,
-	}
+	}, nil
 }
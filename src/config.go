@@ -3,6 +3,7 @@ package dnscli
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -23,25 +24,101 @@ var (
 
 type Config struct {
 	Providers map[string]map[string]string
-	Domains   map[string]string
+	Domains   map[string]DomainConfig
 	Tsig      string
+	Keys      []TsigKey
 	Listen    string
+	// CacheTTL is how long the daemon keeps a zone listing, in seconds, 0
+	// lists the zone for every query.
+	CacheTTL int
+	// CacheRefresh lists every zone again in the background every
+	// CacheRefresh seconds, 0 disables it.
+	CacheRefresh int
+	// Public zones are answered to queries without TSIG.
+	Public []string
+	// RateLimit bounds the unsigned UDP responses per second to a client
+	// network, 0 does not limit them. Every RateSlip-th dropped response is
+	// sent truncated, 0 drops them all.
+	RateLimit int
+	RateSlip  int
+	// MaxUDPSize is the largest UDP response sent to EDNS0 clients.
+	MaxUDPSize int
+	// TLSListen and HTTPSListen are the addresses of the DNS over TLS and
+	// DNS over HTTPS listeners, both use TLSCert and TLSKey.
+	TLSListen   string
+	HTTPSListen string
+	TLSCert     string
+	TLSKey      string
+	// MetricsListen is the address serving /metrics, /healthz and /readyz
+	// over plain HTTP.
+	MetricsListen string
+	// AuditLog receives a JSON line per UPDATE and command line change,
+	// either a file path or "syslog".
+	AuditLog string
+	// APIListen is the address of `dns serve-api`, APITokens the bearer
+	// tokens it accepts.
+	APIListen string
+	APITokens []APIToken
+	// AcmeDNSListen is the address of `dns acme-dns`. Accounts are kept in
+	// AcmeDNSStorage and update the TXT record of their subdomain of
+	// AcmeDNSDomain. Only AcmeDNSRegisterFrom may register.
+	AcmeDNSListen       string
+	AcmeDNSDomain       string
+	AcmeDNSStorage      string
+	AcmeDNSRegisterFrom []string
+	// WebhookListen is the address of `dns webhook`, the external-dns
+	// webhook provider.
+	WebhookListen string
+	// PropagationTimeout is how long, in seconds, to wait for every
+	// authoritative nameserver to serve a change.
+	PropagationTimeout int
+	// DDNS are the names kept current by `dns ddns`, DDNSEcho4 and DDNSEcho6
+	// the HTTP endpoints answering the public IPv4 and IPv6 address.
+	DDNS      []DDNSName
+	DDNSEcho4 []string
+	DDNSEcho6 []string
+	// Failover are the records switched by `dns failover`, which remembers
+	// their state in the FailoverState file.
+	Failover      []FailoverRecord
+	FailoverState string
 }
 
 func (s *Config) Load(path string) *Config {
+	config, err := loadConfig(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	*s = *config
+	return s
+}
+
+// loadConfig reads the config file at path, or at DNSCLI_CONFIG when path is
+// empty.
+func loadConfig(path string) (*Config, error) {
 	if path == "" {
 		path = os.Getenv("DNSCLI_CONFIG")
 	}
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Load config error, %s", err)
+		return nil, fmt.Errorf("load config error, %s", err)
+	}
+	s := &Config{
+		Listen:              "[::]:53",
+		RateSlip:            2,
+		MaxUDPSize:          1232,
+		APIListen:           "127.0.0.1:8053",
+		AcmeDNSListen:       "127.0.0.1:8054",
+		AcmeDNSRegisterFrom: []string{"127.0.0.1/32", "::1/128"},
+		WebhookListen:       "127.0.0.1:8888",
+		PropagationTimeout:  300,
+		DDNSEcho4:           []string{"https://api.ipify.org", "https://ipv4.icanhazip.com"},
+		DDNSEcho6:           []string{"https://api6.ipify.org", "https://ipv6.icanhazip.com"},
 	}
-	s.Listen = "[::]:53"
 	err = json.Unmarshal(data, s)
 	if err != nil {
-		log.Fatalf("Parse config error, %s", err)
+		return nil, fmt.Errorf("parse config error, %s", err)
 	}
-	return s
+	return s, nil
 }
 
 func (s *Config) parseTsig() (alg, name, secret string, err error) {
@@ -0,0 +1,201 @@
+package dnscli
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// conformanceStep is one call made on a provider, and the zone content
+// expected after it.
+type conformanceStep struct {
+	name    string
+	call    func(p DNSProvider) (*RecordChanges, error)
+	wantErr bool
+	// changes are the RRsets the call reports added and deleted.
+	added   []DNSRecord
+	deleted []DNSRecord
+	zone    []DNSRecord
+}
+
+const conformanceZone = "example.com."
+
+var conformanceSteps = []conformanceStep{
+	{
+		name: "present creates",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Present(conformanceZone, "www.example.com.", "A", "192.0.2.1", 300)
+		},
+		added: []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}},
+		zone:  []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}},
+	},
+	{
+		name: "present replaces",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Present(conformanceZone, "www.example.com.", "A", "192.0.2.2", 60)
+		},
+		added:   []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.2"}}},
+		deleted: []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}},
+		zone:    []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.2"}}},
+	},
+	{
+		name: "present other type keeps rrset",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Present(conformanceZone, "www.example.com.", "TXT", "hello world", 300)
+		},
+		added: []DNSRecord{{"www.example.com.", "TXT", 300, []string{"hello world"}}},
+		zone: []DNSRecord{
+			{"www.example.com.", "A", 60, []string{"192.0.2.2"}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "present rrset with several values",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.(RRsetProvider).PresentRRset(conformanceZone, DNSRecord{"mail.example.com.", "MX", 300,
+				[]string{"10 mx1.example.com.", "20 mx2.example.com."}})
+		},
+		added: []DNSRecord{{"mail.example.com.", "MX", 300, []string{"10 mx1.example.com.", "20 mx2.example.com."}}},
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"10 mx1.example.com.", "20 mx2.example.com."}},
+			{"www.example.com.", "A", 60, []string{"192.0.2.2"}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "present rrset shrinks",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.(RRsetProvider).PresentRRset(conformanceZone, DNSRecord{"mail.example.com.", "MX", 300,
+				[]string{"20 mx2.example.com."}})
+		},
+		added:   []DNSRecord{{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}}},
+		deleted: []DNSRecord{{"mail.example.com.", "MX", 300, []string{"10 mx1.example.com.", "20 mx2.example.com."}}},
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}},
+			{"www.example.com.", "A", 60, []string{"192.0.2.2"}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "present outside zone",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Present(conformanceZone, "www.example.org.", "A", "192.0.2.1", 300)
+		},
+		wantErr: true,
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}},
+			{"www.example.com.", "A", 60, []string{"192.0.2.2"}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "absent removes rrset",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Absent(conformanceZone, "www.example.com.", "A")
+		},
+		deleted: []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.2"}}},
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "absent missing rrset",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Absent(conformanceZone, "www.example.com.", "A")
+		},
+		wantErr: true,
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+	{
+		name: "zones are separate",
+		call: func(p DNSProvider) (*RecordChanges, error) {
+			return p.Present("example.org.", "www.example.org.", "A", "192.0.2.9", 300)
+		},
+		added: []DNSRecord{{"www.example.org.", "A", 300, []string{"192.0.2.9"}}},
+		zone: []DNSRecord{
+			{"mail.example.com.", "MX", 300, []string{"20 mx2.example.com."}},
+			{"www.example.com.", "TXT", 300, []string{"hello world"}},
+		},
+	},
+}
+
+func conformanceKey(record DNSRecord) string {
+	return strings.ToLower(fqdn(record.Name)) + " " + strings.ToUpper(record.Type)
+}
+
+// sortedRRsets merges records of the same name and type into RRsets, ordered
+// by name and type, with sorted values.
+func sortedRRsets(records []DNSRecord) []DNSRecord {
+	result := make([]DNSRecord, 0, len(records))
+	index := make(map[string]int)
+	for _, v := range records {
+		if i, ok := index[conformanceKey(v)]; ok {
+			result[i].Datas = append(result[i].Datas, v.Datas...)
+			continue
+		}
+		index[conformanceKey(v)] = len(result)
+		result = append(result, copyRecord(v))
+	}
+	for _, v := range result {
+		sort.Strings(v.Datas)
+	}
+	sort.Slice(result, func(i, j int) bool { return conformanceKey(result[i]) < conformanceKey(result[j]) })
+	return result
+}
+
+func sameRRsets(l, r []DNSRecord) bool {
+	l, r = sortedRRsets(l), sortedRRsets(r)
+	if len(l) != len(r) {
+		return false
+	}
+	for i := range l {
+		if conformanceKey(l[i]) != conformanceKey(r[i]) || l[i].TTL != r[i].TTL ||
+			strings.Join(l[i].Datas, "\n") != strings.Join(r[i].Datas, "\n") {
+			return false
+		}
+	}
+	return true
+}
+
+func testConformance(t *testing.T, p DNSProvider) {
+	if err := p.Init(); err != nil {
+		t.Fatalf("Init: %s", err)
+	}
+	for _, step := range conformanceSteps {
+		changes, err := step.call(p)
+		if step.wantErr {
+			if err == nil {
+				t.Fatalf("%s: no error", step.name)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		} else {
+			if !sameRRsets(changes.Add, step.added) {
+				t.Errorf("%s: added %v, want %v", step.name, changes.Add, step.added)
+			}
+			if !sameRRsets(changes.Delete, step.deleted) {
+				t.Errorf("%s: deleted %v, want %v", step.name, changes.Delete, step.deleted)
+			}
+		}
+		records, err := p.List(conformanceZone)
+		if err != nil {
+			t.Fatalf("%s: List: %s", step.name, err)
+		}
+		if !sameRRsets(records, step.zone) {
+			t.Fatalf("%s: zone %v, want %v", step.name, sortedRRsets(records), step.zone)
+		}
+	}
+}
+
+func TestMemoryProviderConformance(t *testing.T) {
+	testConformance(t, &MemoryProvider{zones: make(map[string][]DNSRecord)})
+}
+
+func TestSQLiteProviderConformance(t *testing.T) {
+	testConformance(t, &SQLiteProvider{Path: filepath.Join(t.TempDir(), "zones.db")})
+}
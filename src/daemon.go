@@ -1,185 +1,254 @@
 package dnscli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
-func checkPreReq(req dns.RR, records []DNSRecord) int {
-	if req.Header().Class == dns.ClassANY {
-		if req.Header().Rrtype == dns.TypeANY {
-			for _, v := range records {
-				if req.Header().Name == fqdn(v.Name) {
-					return dns.RcodeSuccess
-				}
-			}
-			return dns.RcodeNXRrset
-		} else {
-			for _, v := range records {
-				if req.Header().Name == dns.Fqdn(v.Name) && dns.TypeToString[req.Header().Rrtype] == v.Type {
-					return dns.RcodeSuccess
-				}
-			}
-			return dns.RcodeNXRrset
-		}
-	} else if req.Header().Class == dns.ClassNONE {
-		if req.Header().Rrtype == dns.TypeANY {
-			for _, v := range records {
-				if req.Header().Name == fqdn(v.Name) {
-					return dns.RcodeYXDomain
-				}
-			}
-			return dns.RcodeSuccess
-		} else {
-			for _, v := range records {
-				if req.Header().Name == dns.Fqdn(v.Name) && dns.TypeToString[req.Header().Rrtype] == v.Type {
-					return dns.RcodeYXRrset
-				}
-			}
-			return dns.RcodeSuccess
-		}
-	} else {
-		return dns.RcodeNotImplemented
-	}
+func isTransfer(r *dns.Msg) bool {
+	return len(r.Question) == 1 && (r.Question[0].Qtype == dns.TypeAXFR || r.Question[0].Qtype == dns.TypeIXFR)
 }
 
-func (s *Cli) handleUpdate(r *dns.Msg, m *dns.Msg) {
-	d := r.Question[0].Name
-	domain := s.findDomain(d)
-	if domain == "" {
-		m.SetRcode(r, dns.RcodeNameError)
-		return
+// setEdns0 answers the EDNS0 OPT of r, RFC 6891 §7, and returns the largest
+// UDP response r accepts.
+func (s *Cli) setEdns0(r *dns.Msg, m *dns.Msg) int {
+	opt := r.IsEdns0()
+	if opt == nil {
+		return dns.MinMsgSize
 	}
-	p := s.dnsProviders[domain]
-	if len(r.Answer) > 0 {
-		records, err := p.List(domain)
-		if err != nil {
-			log.Print(err)
-			m.SetRcode(r, dns.RcodeServerFailure)
-			return
-		}
-		for _, rr := range r.Answer {
-			if rcode := checkPreReq(rr, records); rcode != dns.RcodeSuccess {
-				m.SetRcode(r, rcode)
-				return
-			}
-		}
+	m.SetEdns0(uint16(s.Config.MaxUDPSize), false)
+	size := int(opt.UDPSize())
+	if size > s.Config.MaxUDPSize {
+		size = s.Config.MaxUDPSize
 	}
-	if len(r.Ns) > 0 {
-		for _, rr := range r.Ns {
-			if rr.Header().Class == dns.ClassANY || rr.Header().Class == dns.ClassNONE {
-				if rr.Header().Rrtype == dns.TypeANY {
-					m.SetRcode(r, dns.RcodeNotImplemented)
-					return
-				} else {
-					if _, err := p.Absent(domain, rr.Header().Name, dns.TypeToString[rr.Header().Rrtype]); err != nil {
-						log.Print(err)
-						m.SetRcode(r, dns.RcodeServerFailure)
-						return
-					}
-				}
-			} else if rr.Header().Class == dns.ClassINET {
-				record := RR2DNSRecord([]dns.RR{rr})[0]
-				if _, err := p.Present(domain, record.Name, record.Type, strings.Join(record.Datas, " "), record.TTL); err != nil {
-					log.Print(err)
-					m.SetRcode(r, dns.RcodeServerFailure)
-					return
-				}
-			}
-		}
+	if size < dns.MinMsgSize {
+		size = dns.MinMsgSize
 	}
-	m.SetRcode(r, dns.RcodeSuccess)
+	return size
 }
 
-func (s *Cli) handleQuery(r *dns.Msg, m *dns.Msg) {
-	if len(r.Question) != 1 {
-		m.SetRcode(r, dns.RcodeNotImplemented)
-		return
-	}
-	record := r.Question[0].Name
-	recordType := dns.TypeToString[r.Question[0].Qtype]
-	domain := s.findDomain(record)
-	if domain == "" {
-		m.SetRcode(r, dns.RcodeNameError)
+// tsigLen returns the size of the TSIG record signing a response with t.
+func tsigLen(t *dns.TSIG) int {
+	return dns.Len(&dns.TSIG{
+		Hdr:       dns.RR_Header{Name: t.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+		Algorithm: t.Algorithm,
+		MAC:       strings.Repeat("00", 64),
+	})
+}
+
+// fitSigned truncates m to size once its TSIG of tsigSize is added. Truncate
+// never goes below 512 bytes, so a response still too long keeps nothing but
+// its header and OPT, the client retries over TCP.
+func fitSigned(m *dns.Msg, size, tsigSize int) {
+	m.Truncate(size - tsigSize)
+	if m.Len()+tsigSize <= size {
 		return
 	}
-	p := s.dnsProviders[domain]
-	records, err := p.List(domain)
-	if err != nil {
-		log.Print(err)
-		m.SetRcode(r, dns.RcodeServerFailure)
-		return
+	opt := m.IsEdns0()
+	m.Truncated = true
+	m.Answer, m.Ns, m.Extra = nil, nil, nil
+	if opt != nil {
+		m.Extra = []dns.RR{opt}
 	}
-	if recordType == "ANY" {
-		for _, v := range records {
-			if record == v.Name {
-				data := fmt.Sprintf("%s %d %s %s %s", v.Name, v.TTL, "IN", v.Type, strings.Join(v.Datas, " "))
-				ans, err := dns.NewRR(data)
-				if err != nil {
-					log.Print(err)
-					m.SetRcode(r, dns.RcodeServerFailure)
-					return
-				}
-				m.Answer = append(m.Answer, ans)
-			}
-		}
-	} else {
-		for _, v := range records {
-			if record == v.Name && recordType == v.Type {
-				data := fmt.Sprintf("%s %d %s %s %s", v.Name, v.TTL, "IN", v.Type, strings.Join(v.Datas, " "))
-				ans, err := dns.NewRR(data)
-				if err != nil {
-					log.Print(err)
-					m.SetRcode(r, dns.RcodeServerFailure)
-					return
-				}
-				m.Answer = append(m.Answer, ans)
-			}
-		}
-	}
-	m.SetRcode(r, dns.RcodeSuccess)
 }
 
 func (s *Cli) handler(w dns.ResponseWriter, r *dns.Msg) {
 	m := new(dns.Msg)
 	m.SetReply(r)
 	//log.Printf("------REQ-----\n%s\n", r.String())
-	if r.IsTsig() != nil {
-		if w.TsigStatus() == nil {
+	s.reloadLock.RLock()
+	defer s.reloadLock.RUnlock()
+	zone := ""
+	if len(r.Question) == 1 && r.Opcode == dns.OpcodeUpdate {
+		// An UPDATE names its zone, a parent domain does not serve it.
+		zone = s.findZone(r.Question[0].Name)
+	} else if len(r.Question) == 1 {
+		zone = s.findDomain(r.Question[0].Name)
+	}
+	defer func() {
+		s.metrics.request(zone, r.Opcode, m.Rcode)
+	}()
+	var changes *RecordChanges
+	var updateErr error
+	if r.Opcode == dns.OpcodeUpdate {
+		start := time.Now()
+		defer func() {
+			s.auditUpdate(w, r, start, changes, updateErr, m.Rcode)
+		}()
+	}
+	t := r.IsTsig()
+	signed := false
+	if t != nil {
+		key, ok := s.keys.get(t.Hdr.Name)
+		if ok && w.TsigStatus() == nil {
 			if r.Opcode == dns.OpcodeUpdate {
-				s.handleUpdate(r, m)
-				m.SetTsig(s.tsigName, s.tsigAlg, 300, time.Now().Unix())
+				changes, updateErr = s.handleUpdate(r, m, key)
+				signed = true
 			} else if r.Opcode == dns.OpcodeQuery {
-				s.handleQuery(r, m)
-				m.SetTsig(s.tsigName, s.tsigAlg, 300, time.Now().Unix())
+				if isTransfer(r) {
+					if s.handleTransfer(w, r, m, key) {
+						return
+					}
+				} else {
+					s.handleQuery(r, m, key)
+				}
+				signed = true
 			}
 		} else {
+			s.metrics.tsigFailure()
 			m.SetRcode(r, dns.RcodeNotAuth)
 		}
+	} else if s.publicKey != nil && r.Opcode == dns.OpcodeQuery && !isTransfer(r) {
+		s.handleQuery(r, m, s.publicKey)
 	} else {
 		if r.Opcode == dns.OpcodeUpdate {
 			m.SetRcode(r, dns.RcodeNotAuth)
 		}
 		m.SetRcode(r, dns.RcodeRefused)
 	}
+	size := s.setEdns0(r, m)
+	if w.RemoteAddr().Network() == "udp" {
+		if s.limiter != nil && !signed {
+			if allow, slip := s.limiter.check(w.RemoteAddr()); !allow {
+				if slip {
+					tc := new(dns.Msg)
+					tc.SetReply(r)
+					tc.Truncated = true
+					w.WriteMsg(tc)
+				}
+				return
+			}
+		}
+		if signed {
+			fitSigned(m, size, tsigLen(t))
+		} else {
+			m.Truncate(size)
+		}
+	}
+	if signed {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, 300, time.Now().Unix())
+	}
 	//log.Printf("-----RSP------\n%s\n", m.String())
-	defer w.WriteMsg(m)
+	w.WriteMsg(m)
 }
 
-func (s *Cli) Listen() {
-	var err error
-	for _, v := range s.dnsProviders {
-		v.Init()
+// drainTimeout bounds how long a shutdown waits for requests in progress.
+const drainTimeout = 30 * time.Second
+
+// setup initializes the providers and builds the daemon state from Config.
+func (s *Cli) setup() error {
+	s.instrument()
+	for k, v := range s.dnsProviders {
+		if err := v.Init(); err != nil {
+			return fmt.Errorf("init provider for %s error, %s", k, err)
+		}
 	}
-	s.tsigAlg, s.tsigName, s.tsigSecret, err = s.Config.parseTsig()
+	keys, err := s.Config.tsigKeys()
 	if err != nil {
+		return err
+	}
+	s.keys.set(keys)
+	s.publicKey = nil
+	if len(s.Config.Public) > 0 {
+		for _, v := range s.Config.Public {
+			if s.findZone(fqdn(v)) == "" {
+				return fmt.Errorf("public zone %s is not a configured domain", v)
+			}
+		}
+		s.publicKey = &TsigKey{Name: "public", Zones: s.Config.Public, Query: true}
+	}
+	if len(keys) == 0 && s.publicKey == nil {
+		return errors.New("no tsig key or public zone configured")
+	}
+	s.limiter = nil
+	if s.Config.RateLimit > 0 {
+		s.limiter = newRateLimiter(s.Config.RateLimit, s.Config.RateSlip)
+	}
+	s.cache = newZoneCache(time.Duration(s.Config.CacheTTL) * time.Second)
+	s.audit, err = openAuditLog(s.Config.AuditLog)
+	return err
+}
+
+func (s *Cli) startCache() {
+	s.cache.start(s.dnsProviders, time.Duration(s.Config.CacheRefresh)*time.Second)
+}
+
+// reload reads the config file again and switches to it once every provider
+// and key loaded. On error the running config is kept. Listen addresses and
+// certificates files are only read at start.
+func (s *Cli) reload() error {
+	config, err := loadConfig(s.configPath)
+	if err != nil {
+		return err
+	}
+	next := &Cli{Config: *config, dnsProviders: make(map[string]DNSProvider), metrics: s.metrics}
+	if _, err := next.Load(); err != nil {
+		return err
+	}
+	if err := next.setup(); err != nil {
+		return err
+	}
+	// Wait for the requests in progress, so none sees a mix of both configs.
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	old := s.Config
+	if next.Config.Listen != old.Listen || next.TLSListen != old.TLSListen || next.HTTPSListen != old.HTTPSListen ||
+		next.TLSCert != old.TLSCert || next.TLSKey != old.TLSKey {
+		log.Print("Listen addresses and certificates are only changed by a restart")
+	}
+	s.cache.close()
+	s.Config = next.Config
+	s.dnsProviders = next.dnsProviders
+	s.keys.set(next.keys.keys)
+	s.publicKey = next.publicKey
+	s.limiter = next.limiter
+	s.cache = next.cache
+	s.audit.close()
+	s.audit = next.audit
+	s.startCache()
+	return nil
+}
+
+// shutdown stops every server from reading new requests and waits, up to
+// drainTimeout, for the ones in progress and their provider calls.
+func shutdown(servers []*dns.Server, httpServers []*http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	wg := sync.WaitGroup{}
+	for _, v := range servers {
+		wg.Add(1)
+		go func(server *dns.Server) {
+			defer wg.Done()
+			if err := server.ShutdownContext(ctx); err != nil {
+				log.Printf("Shutdown %s %s, %s", server.Net, server.Addr, err)
+			}
+		}(v)
+	}
+	for _, v := range httpServers {
+		if err := v.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown http %s, %s", v.Addr, err)
+		}
+	}
+	wg.Wait()
+}
+
+func (s *Cli) Listen() {
+	s.metrics = newMetrics()
+	if err := s.setup(); err != nil {
 		log.Fatal(err)
 	}
+	s.startCache()
 	acceptFunc := func(dh dns.Header) dns.MsgAcceptAction {
 		if isResponse := dh.Bits&32768 != 0; isResponse {
 			return dns.MsgIgnore
@@ -192,35 +261,80 @@ func (s *Cli) Listen() {
 		}
 		return dns.MsgAccept
 	}
-	serverTCP := &dns.Server{
-		Net:  "tcp",
-		Addr: s.Config.Listen,
-		TsigSecret: map[string]string{
-			s.tsigName: s.tsigSecret,
-		},
-		MsgAcceptFunc: acceptFunc,
-	}
-	serverUDP := &dns.Server{
-		Net:  "udp",
-		Addr: s.Config.Listen,
-		TsigSecret: map[string]string{
-			s.tsigName: s.tsigSecret,
-		},
-		MsgAcceptFunc: acceptFunc,
+	servers := []*dns.Server{
+		{Net: "tcp", Addr: s.Config.Listen},
+		{Net: "udp", Addr: s.Config.Listen},
 	}
-	handler := dns.HandlerFunc(s.handler)
-	wg := sync.WaitGroup{}
-	run := func(server *dns.Server) {
-		server.Handler = handler
-		err = server.ListenAndServe()
+	httpServers := make([]*http.Server, 0)
+	tlsServers := make(map[*http.Server]bool)
+	if s.Config.MetricsListen != "" {
+		httpServers = append(httpServers, &http.Server{
+			Addr:    s.Config.MetricsListen,
+			Handler: http.HandlerFunc(s.serveMetrics),
+		})
+	}
+	if s.Config.TLSListen != "" || s.Config.HTTPSListen != "" {
+		certs, err := newCertLoader(s.Config.TLSCert, s.Config.TLSKey)
 		if err != nil {
-			log.Fatal(err)
+			log.Fatalf("Load certificate error, %s", err)
+		}
+		if s.Config.TLSListen != "" {
+			servers = append(servers, &dns.Server{Net: "tcp-tls", Addr: s.Config.TLSListen, TLSConfig: certs.tlsConfig()})
 		}
-		wg.Done()
+		if s.Config.HTTPSListen != "" {
+			server := &http.Server{
+				Addr:      s.Config.HTTPSListen,
+				Handler:   &dohHandler{handler: dns.HandlerFunc(s.handler), keys: &s.keys},
+				TLSConfig: certs.tlsConfig(),
+			}
+			httpServers = append(httpServers, server)
+			tlsServers[server] = true
+		}
+	}
+	handler := dns.HandlerFunc(s.handler)
+	wg := sync.WaitGroup{}
+	for _, v := range servers {
+		v.Handler = handler
+		v.TsigProvider = &s.keys
+		v.MsgAcceptFunc = acceptFunc
+		wg.Add(1)
+		go func(server *dns.Server) {
+			defer wg.Done()
+			if err := server.ListenAndServe(); err != nil {
+				log.Fatal(err)
+			}
+		}(v)
+	}
+	for _, v := range httpServers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			var err error
+			if tlsServers[server] {
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}(v)
 	}
-	wg.Add(1)
-	go run(serverTCP)
-	wg.Add(1)
-	go run(serverUDP)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				log.Printf("Received %s, draining", sig)
+				shutdown(servers, httpServers)
+				return
+			}
+			if err := s.reload(); err != nil {
+				log.Printf("Reload config failed, keep the running one, %s", err)
+			} else {
+				log.Print("Config reloaded")
+			}
+		}
+	}()
 	wg.Wait()
 }
@@ -0,0 +1,259 @@
+package dnscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DDNSName is a name kept current by `dns ddns`. Types defaults to A and
+// AAAA, a family without address is then skipped. Interface takes the
+// addresses of a local interface instead of asking the echo endpoints.
+type DDNSName struct {
+	Name      string
+	Types     []string
+	Interface string
+	TTL       int
+}
+
+// addressDetector finds the public addresses once per round, whatever the
+// number of names using them.
+type addressDetector struct {
+	echo4 []string
+	echo6 []string
+	found map[string]string
+	errs  map[string]error
+}
+
+func newAddressDetector(echo4, echo6 []string) *addressDetector {
+	return &addressDetector{
+		echo4: echo4,
+		echo6: echo6,
+		found: make(map[string]string),
+		errs:  make(map[string]error),
+	}
+}
+
+func (s *addressDetector) address(iface, recordType string) (string, error) {
+	key := iface + " " + recordType
+	if v, ok := s.found[key]; ok {
+		return v, nil
+	}
+	if err, ok := s.errs[key]; ok {
+		return "", err
+	}
+	var addr string
+	var err error
+	switch {
+	case iface != "":
+		addr, err = interfaceAddress(iface, recordType == "AAAA")
+	case recordType == "AAAA":
+		addr, err = echoAddress(s.echo6, "tcp6")
+	default:
+		addr, err = echoAddress(s.echo4, "tcp4")
+	}
+	if err != nil {
+		s.errs[key] = err
+		return "", err
+	}
+	s.found[key] = addr
+	return addr, nil
+}
+
+// echoAddress asks the endpoints, over network, for the address they see,
+// the first one answering wins.
+func echoAddress(urls []string, network string) (string, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	client := &http.Client{
+		Timeout: 15 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+	err := errors.New("no echo endpoint")
+	for _, v := range urls {
+		var resp *http.Response
+		if resp, err = client.Get(v); err != nil {
+			continue
+		}
+		body, readErr := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+		resp.Body.Close()
+		if readErr != nil || resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("%s answered %s", v, resp.Status)
+			continue
+		}
+		ip := net.ParseIP(strings.TrimSpace(string(body)))
+		if ip == nil || (ip.To4() != nil) != (network == "tcp4") {
+			err = fmt.Errorf("%s answered no address", v)
+			continue
+		}
+		return ip.String(), nil
+	}
+	return "", err
+}
+
+// interfaceAddress returns the first global address of the interface, IPv6
+// unique local addresses are skipped.
+func interfaceAddress(name string, ipv6 bool) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, v := range addrs {
+		network, ok := v.(*net.IPNet)
+		if !ok || !network.IP.IsGlobalUnicast() || (network.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		if ipv6 && network.IP[0]&0xfe == 0xfc {
+			continue
+		}
+		return network.IP.String(), nil
+	}
+	if ipv6 {
+		return "", fmt.Errorf("no global IPv6 address on %s", name)
+	}
+	return "", fmt.Errorf("no global IPv4 address on %s", name)
+}
+
+// parseInterval removes the --interval option from args, in seconds or as a
+// duration like 5m.
+func parseInterval(args []string) ([]string, time.Duration, error) {
+	result := make([]string, 0, len(args))
+	interval := time.Duration(0)
+	for i := 0; i < len(args); i++ {
+		if args[i] != "--interval" && args[i] != "-interval" {
+			result = append(result, args[i])
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, 0, errors.New("empty interval")
+		}
+		i++
+		if seconds, err := strconv.Atoi(args[i]); err == nil {
+			interval = time.Duration(seconds) * time.Second
+		} else if interval, err = time.ParseDuration(args[i]); err != nil {
+			return nil, 0, fmt.Errorf("invalid interval %s", args[i])
+		}
+	}
+	return result, interval, nil
+}
+
+// updateDDNS sets every name to the current addresses, a record is only
+// changed when its address did. It tells whether something failed.
+func (s *Cli) updateDDNS(names []DDNSName) bool {
+	detector := newAddressDetector(s.Config.DDNSEcho4, s.Config.DDNSEcho6)
+	failed := false
+	for _, v := range names {
+		name := fqdn(v.Name)
+		domain := s.findDomain(name)
+		provider := s.dnsProviders[domain]
+		types := v.Types
+		if len(types) == 0 {
+			types = []string{"A", "AAAA"}
+		}
+		ttl := v.TTL
+		if ttl == 0 {
+			ttl = 300
+		}
+		detected := false
+		for _, t := range types {
+			t = strings.ToUpper(t)
+			addr, err := detector.address(v.Interface, t)
+			if err != nil {
+				log.Printf("Detect %s address for %s error, %s", t, name, err)
+				failed = failed || len(v.Types) > 0
+				continue
+			}
+			detected = true
+			current, err := listRRset(provider, domain, name, t)
+			if err != nil {
+				log.Printf("List %s error, %s", domain, err)
+				failed = true
+				continue
+			}
+			if sameDatas(normalizeDatas(name, t, current), []string{addr}) {
+				continue
+			}
+			start := time.Now()
+			changes, err := provider.Present(domain, name, t, addr, ttl)
+			s.auditCommand(domain, start, changes, err)
+			if err = primaryError(err); err != nil {
+				log.Printf("Set %s %s error, %s", name, t, err)
+				failed = true
+				continue
+			}
+			log.Printf("Set %s %s to %s", name, t, addr)
+		}
+		// Without Types a missing family is fine, but not both.
+		if !detected {
+			failed = true
+		}
+	}
+	return failed
+}
+
+// DDNS runs `dns ddns [name...] [--interval duration]`, keeping the names,
+// or the DDNS entries of the config, current. Without interval it runs
+// once.
+func (s *Cli) DDNS(args []string) {
+	args, interval, err := parseInterval(args)
+	if err != nil {
+		fmt.Printf("%s.\n", err.Error())
+		os.Exit(1)
+	}
+	names := s.Config.DDNS
+	if len(args) > 0 {
+		names = make([]DDNSName, 0, len(args))
+		for _, v := range args {
+			names = append(names, DDNSName{Name: v})
+		}
+	}
+	if len(names) == 0 {
+		fmt.Println("Please input names or set DDNS in config.")
+		os.Exit(1)
+	}
+	inited := make(map[DNSProvider]bool)
+	for _, v := range names {
+		for _, t := range v.Types {
+			if t = strings.ToUpper(t); t != "A" && t != "AAAA" {
+				fmt.Printf("Record %s: type %s not A or AAAA.\n", v.Name, t)
+				os.Exit(1)
+			}
+		}
+		domain := s.findDomain(fqdn(v.Name))
+		if domain == "" {
+			fmt.Printf("Domain of %s not found\n", v.Name)
+			os.Exit(1)
+		}
+		if p := s.dnsProviders[domain]; !inited[p] {
+			s.initProvider(domain)
+			inited[p] = true
+		}
+	}
+	s.openAudit()
+	for {
+		failed := s.updateDDNS(names)
+		if interval == 0 {
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+		time.Sleep(interval)
+	}
+}
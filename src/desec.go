@@ -0,0 +1,172 @@
+package dnscli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DesecAPIURL = "https://desec.io/api/v1"
+
+type desecRRset struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+type DesecProvider struct {
+	Endpoint string
+	Token    string
+	client   *restClient
+}
+
+func (s *DesecProvider) rrsetPath(Domain, Record, Type string) string {
+	// deSEC addresses the apex as "@" in URLs and as "" in bodies.
+	return fmt.Sprintf("/domains/%s/rrsets/%s/%s/", url.PathEscape(defqdn(Domain)),
+		url.PathEscape(subName(Domain, Record, "@")), url.PathEscape(Type))
+}
+
+func (s *DesecProvider) toRecord(Domain string, v desecRRset) DNSRecord {
+	return DNSRecord{absName(Domain, v.Subname, ""), v.Type, v.TTL, textDatas(v.Type, v.Records)}
+}
+
+func (s *DesecProvider) List(Domain string) ([]DNSRecord, error) {
+	result := make([]DNSRecord, 0)
+	// An empty cursor asks for the first page, deSEC then links the next one.
+	next := fmt.Sprintf("/domains/%s/rrsets/?cursor=", url.PathEscape(defqdn(Domain)))
+	for next != "" {
+		rrsets := make([]desecRRset, 0)
+		header, err := s.client.do("GET", next, nil, &rrsets)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range rrsets {
+			result = append(result, s.toRecord(Domain, v))
+		}
+		next = nextLink(header)
+	}
+	return result, nil
+}
+
+func (s *DesecProvider) get(Domain, Record, Type string) (*DNSRecord, error) {
+	rrset := desecRRset{}
+	if _, err := s.client.do("GET", s.rrsetPath(Domain, Record, Type), nil, &rrset); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	record := s.toRecord(Domain, rrset)
+	return &record, nil
+}
+
+func (s *DesecProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *DesecProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.get(Domain, record.Name, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	body := desecRRset{
+		Subname: subName(Domain, record.Name, ""),
+		Type:    record.Type,
+		TTL:     record.TTL,
+		Records: zoneDatas(record),
+	}
+	// A PATCH on the RRset collection creates or replaces the RRsets in the
+	// body and leaves the others untouched.
+	path := fmt.Sprintf("/domains/%s/rrsets/", url.PathEscape(defqdn(Domain)))
+	if _, err := s.client.do("PATCH", path, []desecRRset{body}, nil); err != nil {
+		return nil, err
+	}
+	recordChanges := &RecordChanges{Add: []DNSRecord{record}}
+	if old != nil {
+		recordChanges.Delete = []DNSRecord{*old}
+	}
+	return recordChanges, nil
+}
+
+// ApplyChanges sends every RRset in one bulk request, deSEC applies it
+// atomically. An RRset with no records is deleted.
+func (s *DesecProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	body := make([]desecRRset, 0, len(changes.Add)+len(changes.Delete))
+	added := make(map[string]bool)
+	for _, v := range changes.Add {
+		record, err := checkRecord(Domain, v)
+		if err != nil {
+			return nil, err
+		}
+		added[rrsetKey(record)] = true
+		body = append(body, desecRRset{
+			Subname: subName(Domain, record.Name, ""),
+			Type:    record.Type,
+			TTL:     record.TTL,
+			Records: zoneDatas(record),
+		})
+	}
+	for _, v := range changes.Delete {
+		if added[rrsetKey(v)] {
+			continue
+		}
+		body = append(body, desecRRset{
+			Subname: subName(Domain, v.Name, ""),
+			Type:    strings.ToUpper(v.Type),
+			Records: []string{},
+		})
+	}
+	path := fmt.Sprintf("/domains/%s/rrsets/", url.PathEscape(defqdn(Domain)))
+	if _, err := s.client.do("PATCH", path, body, nil); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
+func (s *DesecProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	old, err := s.get(Domain, Record, Type)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return nil, errors.New("records not found")
+	}
+	if _, err := s.client.do("DELETE", s.rrsetPath(Domain, Record, Type), nil, nil); err != nil {
+		return nil, err
+	}
+	return &RecordChanges{Delete: []DNSRecord{*old}}, nil
+}
+
+func (s *DesecProvider) Init() error {
+	if s.client != nil {
+		return nil
+	}
+	s.client = newRestClient(s.Endpoint, http.Header{
+		"Authorization": []string{"Token " + s.Token},
+	})
+	return nil
+}
+
+func init() {
+	RegisterProvider("Desec", NewDesecProvider, "Token")
+}
+
+func NewDesecProvider(info map[string]string) (DNSProvider, error) {
+	p := &DesecProvider{Endpoint: DesecAPIURL}
+	if v, ok := info["Token"]; ok && v != "" {
+		p.Token = v
+	} else {
+		return nil, errors.New("desec: Token not found")
+	}
+	if v, ok := info["Endpoint"]; ok && v != "" {
+		p.Endpoint = v
+	}
+	return p, nil
+}
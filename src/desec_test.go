@@ -0,0 +1,94 @@
+package dnscli
+
+import "testing"
+
+func TestDesecList(t *testing.T) {
+	p := fixtureProvider(t, "Desec", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/?cursor=",
+			Header: map[string]string{"Link": `<{{server}}/domains/example.com/rrsets/?cursor=>; rel="first", ` +
+				`<{{server}}/domains/example.com/rrsets/?cursor=c2>; rel="next"`},
+			Body: `[
+				{"domain":"example.com","subname":"","name":"example.com.","type":"NS","records":["ns1.desec.io."],"ttl":3600},
+				{"domain":"example.com","subname":"www","name":"www.example.com.","type":"A","records":["192.0.2.1","192.0.2.2"],"ttl":60}
+			]`,
+		},
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/?cursor=c2",
+			Header: map[string]string{"Link": `<{{server}}/domains/example.com/rrsets/?cursor=>; rel="first"`},
+			Body:   `[{"domain":"example.com","subname":"www","name":"www.example.com.","type":"TXT","records":["\"hello\""],"ttl":60}]`,
+		},
+	})
+	records, err := p.List("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "records", records, []DNSRecord{
+		{"example.com.", "NS", 3600, []string{"ns1.desec.io."}},
+		{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2"}},
+		{"www.example.com.", "TXT", 60, []string{"hello"}},
+	})
+}
+
+func TestDesecPresent(t *testing.T) {
+	p := fixtureProvider(t, "Desec", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/www/A/",
+			Body: `{"domain":"example.com","subname":"www","name":"www.example.com.","type":"A","records":["192.0.2.1","192.0.2.2"],"ttl":60}`,
+		},
+		{
+			Method: "PATCH", URI: "/domains/example.com/rrsets/",
+			Request: `[{"subname":"www","type":"A","ttl":3600,"records":["192.0.2.9"]}]`,
+			Body:    `[{"domain":"example.com","subname":"www","name":"www.example.com.","type":"A","records":["192.0.2.9"],"ttl":3600}]`,
+		},
+	})
+	changes, err := p.Present("example.com.", "www.example.com.", "A", "192.0.2.9", 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"www.example.com.", "A", 3600, []string{"192.0.2.9"}}})
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2"}}})
+}
+
+func TestDesecPresentTXT(t *testing.T) {
+	p := fixtureProvider(t, "Desec", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/_acme-challenge/TXT/",
+			Status: 404,
+			Body:   `{"detail":"Not found."}`,
+		},
+		{
+			Method: "PATCH", URI: "/domains/example.com/rrsets/",
+			Request: `[{"subname":"_acme-challenge","type":"TXT","ttl":3600,"records":["\"say \\\"hi\\\"\""]}]`,
+			Body:    `[]`,
+		},
+	})
+	changes, err := p.Present("example.com.", "_acme-challenge.example.com.", "TXT", `say "hi"`, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"_acme-challenge.example.com.", "TXT", 3600, []string{`say "hi"`}}})
+}
+
+func TestDesecAbsent(t *testing.T) {
+	p := fixtureProvider(t, "Desec", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/@/MX/",
+			Body: `{"domain":"example.com","subname":"","name":"example.com.","type":"MX","records":["10 mx.example.com."],"ttl":3600}`,
+		},
+		{Method: "DELETE", URI: "/domains/example.com/rrsets/@/MX/", Status: 204},
+		{
+			Method: "GET", URI: "/domains/example.com/rrsets/@/MX/",
+			Status: 404,
+			Body:   `{"detail":"Not found."}`,
+		},
+	})
+	changes, err := p.Absent("example.com.", "example.com.", "MX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"example.com.", "MX", 3600, []string{"10 mx.example.com."}}})
+	if _, err := p.Absent("example.com.", "example.com.", "MX"); err == nil {
+		t.Error("absent of a missing RRset did not fail")
+	}
+}
@@ -0,0 +1,150 @@
+package dnscli
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	"github.com/miekg/dns"
+)
+
+const dohPath = "/dns-query"
+
+const dohContentType = "application/dns-message"
+
+// dohAddr is the address of a DNS over HTTPS client. Its network is neither
+// udp nor tcp, the handler neither truncates its responses nor streams zone
+// transfers to it.
+type dohAddr struct {
+	net.Addr
+}
+
+func (s dohAddr) Network() string {
+	return "https"
+}
+
+// dohWriter is the dns.ResponseWriter of a DNS over HTTPS request, the one
+// message written is the HTTP response body.
+type dohWriter struct {
+	w          http.ResponseWriter
+	local      net.Addr
+	remote     net.Addr
+	keys       *keyring
+	tsigStatus error
+	requestMAC string
+}
+
+func (s *dohWriter) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *dohWriter) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// WriteMsg signs m like dns.Server does when it holds a TSIG.
+func (s *dohWriter) WriteMsg(m *dns.Msg) error {
+	var data []byte
+	var err error
+	if t := m.IsTsig(); t != nil {
+		key, ok := s.keys.get(t.Hdr.Name)
+		if !ok {
+			return dns.ErrSecret
+		}
+		data, _, err = dns.TsigGenerate(m, key.Secret, s.requestMAC, false)
+	} else {
+		data, err = m.Pack()
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.Write(data)
+	return err
+}
+
+func (s *dohWriter) Write(data []byte) (int, error) {
+	s.w.Header().Set("Content-Type", dohContentType)
+	return s.w.Write(data)
+}
+
+func (s *dohWriter) Close() error {
+	return nil
+}
+
+func (s *dohWriter) TsigStatus() error {
+	return s.tsigStatus
+}
+
+func (s *dohWriter) TsigTimersOnly(bool) {}
+
+func (s *dohWriter) Hijack() {}
+
+// dohHandler serves DNS over HTTPS, RFC 8484, with the handler of the plain
+// DNS servers.
+type dohHandler struct {
+	handler dns.Handler
+	keys    *keyring
+}
+
+// readMsg returns the DNS message of r, base64url encoded in the dns
+// parameter of a GET or the body of a POST.
+func readMsg(w http.ResponseWriter, r *http.Request) ([]byte, int) {
+	switch r.Method {
+	case http.MethodGet:
+		data, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || len(data) == 0 {
+			return nil, http.StatusBadRequest
+		}
+		return data, http.StatusOK
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohContentType {
+			return nil, http.StatusUnsupportedMediaType
+		}
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, dns.MaxMsgSize))
+		if err != nil {
+			return nil, http.StatusRequestEntityTooLarge
+		}
+		return data, http.StatusOK
+	}
+	return nil, http.StatusMethodNotAllowed
+}
+
+func (s *dohHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != dohPath {
+		http.NotFound(w, r)
+		return
+	}
+	data, status := readMsg(w, r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	req := new(dns.Msg)
+	if err := req.Unpack(data); err != nil || req.Response {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+	remote, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	writer := &dohWriter{
+		w:      w,
+		local:  r.Context().Value(http.LocalAddrContextKey).(net.Addr),
+		remote: dohAddr{remote},
+		keys:   s.keys,
+	}
+	if req.Opcode != dns.OpcodeQuery && req.Opcode != dns.OpcodeUpdate {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeNotImplemented)
+		writer.WriteMsg(m)
+		return
+	}
+	if t := req.IsTsig(); t != nil {
+		if key, ok := s.keys.get(t.Hdr.Name); ok {
+			writer.tsigStatus = dns.TsigVerify(data, key.Secret, "", false)
+		} else {
+			writer.tsigStatus = dns.ErrSecret
+		}
+		writer.requestMAC = t.MAC
+	}
+	s.handler.ServeDNS(writer, req)
+}
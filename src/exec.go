@@ -0,0 +1,144 @@
+package dnscli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execRequest is written as JSON to the stdin of the plugin, once per call.
+type execRequest struct {
+	Method string
+	Config map[string]string
+	Domain string     `json:",omitempty"`
+	Record *DNSRecord `json:",omitempty"`
+}
+
+// execResponse is read as JSON from the stdout of the plugin. A non empty
+// Error fails the call whatever the exit status is.
+type execResponse struct {
+	Records []DNSRecord
+	Changes *RecordChanges
+	Error   string
+}
+
+type ExecProvider struct {
+	Command []string
+	Timeout time.Duration
+	config  map[string]string
+}
+
+func (s *ExecProvider) call(request execRequest) (*execResponse, error) {
+	request.Config = s.config
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = os.Stderr
+	output, runErr := cmd.Output()
+	response := &execResponse{}
+	if err := json.Unmarshal(output, response); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("exec %s: %s", request.Method, runErr)
+		}
+		return nil, fmt.Errorf("exec %s: bad response, %s", request.Method, err)
+	}
+	if response.Error != "" {
+		return nil, errors.New(response.Error)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("exec %s: %s", request.Method, runErr)
+	}
+	return response, nil
+}
+
+func (s *ExecProvider) List(Domain string) ([]DNSRecord, error) {
+	response, err := s.call(execRequest{Method: "List", Domain: fqdn(Domain)})
+	if err != nil {
+		return nil, err
+	}
+	if response.Records == nil {
+		return make([]DNSRecord, 0), nil
+	}
+	return response.Records, nil
+}
+
+func (s *ExecProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *ExecProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.call(execRequest{Method: "Present", Domain: fqdn(Domain), Record: &record})
+	if err != nil {
+		return nil, err
+	}
+	if response.Changes == nil {
+		return &RecordChanges{Add: []DNSRecord{record}}, nil
+	}
+	return response.Changes, nil
+}
+
+func (s *ExecProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	record := DNSRecord{Name: fqdn(Record), Type: strings.ToUpper(Type)}
+	response, err := s.call(execRequest{Method: "Absent", Domain: fqdn(Domain), Record: &record})
+	if err != nil {
+		return nil, err
+	}
+	if response.Changes == nil {
+		return &RecordChanges{}, nil
+	}
+	return response.Changes, nil
+}
+
+func (s *ExecProvider) Init() error {
+	_, err := s.call(execRequest{Method: "Init"})
+	return err
+}
+
+func init() {
+	RegisterProvider("Exec", NewExecProvider, "Command")
+}
+
+// NewExecProvider returns a provider delegating every call to an external
+// executable, see the README for the protocol.
+func NewExecProvider(info map[string]string) (DNSProvider, error) {
+	p := &ExecProvider{
+		Timeout: 60 * time.Second,
+		config:  info,
+	}
+	v := strings.TrimSpace(info["Command"])
+	if strings.HasPrefix(v, "[") {
+		// A JSON array keeps arguments holding spaces or quotes.
+		if err := json.Unmarshal([]byte(v), &p.Command); err != nil {
+			return nil, fmt.Errorf("exec: wrong Command, %s", err)
+		}
+	} else {
+		p.Command = strings.Fields(v)
+	}
+	if len(p.Command) == 0 || p.Command[0] == "" {
+		return nil, errors.New("exec: Command not found")
+	}
+	if v, ok := info["Timeout"]; ok && v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("exec: wrong Timeout %s", v)
+		}
+		p.Timeout = time.Duration(seconds) * time.Second
+	}
+	return p, nil
+}
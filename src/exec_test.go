@@ -0,0 +1,120 @@
+package dnscli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExecHelperProcess is the plugin run by the Exec tests, it answers one
+// request from stdin the way the README describes.
+func TestExecHelperProcess(t *testing.T) {
+	if os.Getenv("DNSCLI_EXEC_HELPER") != "1" {
+		return
+	}
+	request := execRequest{}
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		os.Exit(2)
+	}
+	response := execResponse{}
+	switch {
+	case request.Config["Zone"] != "example.com.":
+		response.Error = "config not passed"
+	case request.Method == "Init":
+	case request.Method == "List":
+		response.Records = []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}}
+	case request.Method == "Present":
+		response.Changes = &RecordChanges{
+			Add:    []DNSRecord{*request.Record},
+			Delete: []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}},
+		}
+	case request.Method == "Absent" && request.Domain != "example.com.":
+		response.Error = "zone not found"
+	case request.Method == "Absent":
+	default:
+		os.Exit(3)
+	}
+	json.NewEncoder(os.Stdout).Encode(response)
+	os.Exit(0)
+}
+
+func execProvider(t *testing.T) DNSProvider {
+	// The test binary is the plugin, linked to a path holding a space.
+	dir := filepath.Join(t.TempDir(), "dns plugin")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "helper")
+	if err := os.Symlink(os.Args[0], path); err != nil {
+		t.Fatal(err)
+	}
+	command, _ := json.Marshal([]string{path, "-test.run=^TestExecHelperProcess$"})
+	os.Setenv("DNSCLI_EXEC_HELPER", "1")
+	t.Cleanup(func() { os.Unsetenv("DNSCLI_EXEC_HELPER") })
+	p, err := newProvider("test", map[string]string{"Type": "Exec", "Command": string(command), "Zone": "example.com."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestExecProvider(t *testing.T) {
+	p := execProvider(t)
+	records, err := p.List("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "records", records, []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}})
+	changes, err := p.Present("example.com.", "www.example.com", "a", "192.0.2.9", 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.9"}}})
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}})
+	if _, err := p.Absent("example.com.", "www.example.com.", "A"); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.Absent("example.net.", "www.example.net.", "A"); err == nil || err.Error() != "zone not found" {
+		t.Errorf("absent error %v, want zone not found", err)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	for _, c := range []struct {
+		Command string
+		Want    []string
+	}{
+		{"/usr/bin/plugin --flag x", []string{"/usr/bin/plugin", "--flag", "x"}},
+		{`["/opt/in house/plugin", "--name", "a b"]`, []string{"/opt/in house/plugin", "--name", "a b"}},
+		{"   ", nil},
+		{"[]", nil},
+		{`["/bin/plugin"`, nil},
+	} {
+		p, err := NewExecProvider(map[string]string{"Command": c.Command})
+		if c.Want == nil {
+			if err == nil {
+				t.Errorf("command %q did not fail", c.Command)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("command %q, %s", c.Command, err)
+			continue
+		}
+		got := p.(*ExecProvider).Command
+		if len(got) != len(c.Want) {
+			t.Errorf("command %q is %q, want %q", c.Command, got, c.Want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.Want[i] {
+				t.Errorf("command %q is %q, want %q", c.Command, got, c.Want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package dnscli
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// FailoverRecord is a record `dns failover` points at its Primary values
+// while Check passes on every one of them, and at its Backup values when it
+// does not.
+type FailoverRecord struct {
+	Name    string
+	Type    string
+	TTL     int
+	Primary []string
+	Backup  []string
+	Check   HealthCheck
+}
+
+// HealthCheck probes each primary value every Interval seconds. Type is
+// tcp, a connection to Port, http or https, a GET of Path answering
+// ExpectStatus or any 2xx or 3xx, or dns, a Query of QueryType answered
+// NOERROR. The primary is given up after Fall failed rounds in a row and
+// taken back after Rise passed ones.
+type HealthCheck struct {
+	Type         string
+	Port         int
+	Path         string
+	Host         string
+	ExpectStatus int
+	Query        string
+	QueryType    string
+	Interval     int
+	Timeout      int
+	Fall         int
+	Rise         int
+	// client runs the http and https checks, it keeps no idle connection
+	// between rounds.
+	client *http.Client
+}
+
+const (
+	failoverPrimary = "primary"
+	failoverBackup  = "backup"
+)
+
+// setDefaults fills the unset fields of the check of record.
+func (s *FailoverRecord) setDefaults() {
+	s.Type = strings.ToUpper(s.Type)
+	if s.TTL == 0 {
+		s.TTL = 60
+	}
+	c := &s.Check
+	c.Type = strings.ToLower(c.Type)
+	if c.Port == 0 {
+		switch c.Type {
+		case "http":
+			c.Port = 80
+		case "https":
+			c.Port = 443
+		case "dns":
+			c.Port = 53
+		}
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.Query == "" {
+		c.Query = s.Name
+	}
+	if c.QueryType == "" {
+		c.QueryType = "SOA"
+	}
+	if c.Interval == 0 {
+		c.Interval = 10
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 5
+	}
+	if c.Fall == 0 {
+		c.Fall = 3
+	}
+	if c.Rise == 0 {
+		c.Rise = 3
+	}
+	c.client = &http.Client{
+		Timeout: time.Duration(c.Timeout) * time.Second,
+		Transport: &http.Transport{
+			// An empty ServerName is the address being checked.
+			TLSClientConfig:   &tls.Config{ServerName: c.Host},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (s *FailoverRecord) validate() error {
+	if len(s.Primary) == 0 || len(s.Backup) == 0 {
+		return fmt.Errorf("record %s: empty primary or backup", s.Name)
+	}
+	if _, ok := dns.StringToType[s.Type]; !ok {
+		return fmt.Errorf("record %s: unknown record type %s", s.Name, s.Type)
+	}
+	switch s.Check.Type {
+	case "tcp", "http", "https":
+	case "dns":
+		if _, ok := dns.StringToType[strings.ToUpper(s.Check.QueryType)]; !ok {
+			return fmt.Errorf("record %s: unknown query type %s", s.Name, s.Check.QueryType)
+		}
+	default:
+		return fmt.Errorf("record %s: unknown check type %q", s.Name, s.Check.Type)
+	}
+	if s.Check.Port == 0 {
+		return fmt.Errorf("record %s: empty check port", s.Name)
+	}
+	return nil
+}
+
+// probe runs the check against value, an address or a host name.
+func (s *HealthCheck) probe(value string) error {
+	timeout := time.Duration(s.Timeout) * time.Second
+	addr := net.JoinHostPort(value, strconv.Itoa(s.Port))
+	switch s.Type {
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "http", "https":
+		host := s.Host
+		if host == "" {
+			host = value
+		}
+		req, err := http.NewRequest(http.MethodGet, s.Type+"://"+addr+s.Path, nil)
+		if err != nil {
+			return err
+		}
+		req.Host = host
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if s.ExpectStatus != 0 && resp.StatusCode != s.ExpectStatus ||
+			s.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 400) {
+			return fmt.Errorf("answered %s", resp.Status)
+		}
+		return nil
+	case "dns":
+		m := new(dns.Msg)
+		m.SetQuestion(fqdn(s.Query), dns.StringToType[strings.ToUpper(s.QueryType)])
+		c := &dns.Client{Timeout: timeout}
+		r, _, err := c.Exchange(m, addr)
+		if err != nil {
+			return err
+		}
+		if r.Rcode != dns.RcodeSuccess {
+			return fmt.Errorf("answered %s", dns.RcodeToString[r.Rcode])
+		}
+		return nil
+	}
+	return errors.New("unknown check type")
+}
+
+// failoverState is what the failover mode remembers of a record across
+// restarts.
+type failoverState struct {
+	Active    string
+	Failures  int
+	Successes int
+	Changed   time.Time
+}
+
+// failoverStore keeps the states in a JSON file, by RRset.
+type failoverStore struct {
+	path   string
+	lock   sync.Mutex
+	states map[string]*failoverState
+}
+
+func loadFailoverStore(path string) (*failoverStore, error) {
+	s := &failoverStore{path: path, states: make(map[string]*failoverState)}
+	if path == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.states); err != nil {
+		return nil, fmt.Errorf("parse %s error, %s", path, err)
+	}
+	return s, nil
+}
+
+func (s *failoverStore) get(key string) failoverState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if v, ok := s.states[key]; ok {
+		return *v
+	}
+	return failoverState{Active: failoverPrimary}
+}
+
+// set saves state, the file is replaced so it is never half written.
+func (s *failoverStore) set(key string, state failoverState) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.states[key] = &state
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.states, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// applyFailover points the record at the values of active, unless it
+// already is.
+func (s *Cli) applyFailover(record FailoverRecord, active string) error {
+	datas := record.Primary
+	if active == failoverBackup {
+		datas = record.Backup
+	}
+	name := fqdn(record.Name)
+	domain := s.findDomain(name)
+	provider := s.dnsProviders[domain]
+	current, err := listRRset(provider, domain, name, record.Type)
+	if err != nil {
+		return err
+	}
+	if sameDatas(normalizeDatas(name, record.Type, current), normalizeDatas(name, record.Type, datas)) {
+		return nil
+	}
+	s.updateLock.Lock()
+	defer s.updateLock.Unlock()
+	start := time.Now()
+	changes, err := presentRRset(provider, domain, DNSRecord{Name: name, Type: record.Type, TTL: record.TTL, Datas: datas})
+	s.auditCommand(domain, start, changes, err)
+	// A replica left behind is reported by replicate-check, setting the
+	// record again would not bring it back.
+	if err = primaryError(err); err == nil {
+		log.Printf("Set %s %s to %s %s", name, record.Type, active, strings.Join(datas, " "))
+	}
+	return err
+}
+
+// watchFailover checks the primary of record every interval and switches
+// the record when its health changed for long enough.
+func (s *Cli) watchFailover(record FailoverRecord, store *failoverStore) {
+	key := rrsetKey(DNSRecord{Name: record.Name, Type: record.Type})
+	applied := false
+	for {
+		failed := make([]string, 0)
+		for _, v := range record.Primary {
+			if err := record.Check.probe(v); err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %s", v, err))
+			}
+		}
+		state := store.get(key)
+		before := state
+		if len(failed) > 0 && state.Failures < record.Check.Fall {
+			state.Failures++
+			state.Successes = 0
+		} else if len(failed) == 0 && state.Successes < record.Check.Rise {
+			state.Successes++
+			state.Failures = 0
+		}
+		if state.Active == failoverPrimary && state.Failures >= record.Check.Fall {
+			log.Printf("Primary of %s down, %s", key, strings.Join(failed, ", "))
+			state.Active, state.Changed, applied = failoverBackup, time.Now(), false
+		} else if state.Active == failoverBackup && state.Successes >= record.Check.Rise {
+			log.Printf("Primary of %s up", key)
+			state.Active, state.Changed, applied = failoverPrimary, time.Now(), false
+		}
+		if state != before {
+			if err := store.set(key, state); err != nil {
+				log.Printf("Save failover state error, %s", err)
+			}
+		}
+		if !applied {
+			if err := s.applyFailover(record, state.Active); err != nil {
+				log.Printf("Set %s error, %s", key, err)
+			} else {
+				applied = true
+			}
+		}
+		time.Sleep(time.Duration(record.Check.Interval) * time.Second)
+	}
+}
+
+// Failover runs `dns failover`, watching every Failover record of the
+// config.
+func (s *Cli) Failover() {
+	if len(s.Config.Failover) == 0 {
+		fmt.Println("No failover record in config.")
+		os.Exit(1)
+	}
+	inited := make(map[DNSProvider]bool)
+	for i := range s.Config.Failover {
+		record := &s.Config.Failover[i]
+		record.setDefaults()
+		if err := record.validate(); err != nil {
+			fmt.Printf("%s.\n", err.Error())
+			os.Exit(1)
+		}
+		domain := s.findDomain(fqdn(record.Name))
+		if domain == "" {
+			fmt.Printf("Domain of %s not found\n", record.Name)
+			os.Exit(1)
+		}
+		if p := s.dnsProviders[domain]; !inited[p] {
+			s.initProvider(domain)
+			inited[p] = true
+		}
+	}
+	store, err := loadFailoverStore(s.Config.FailoverState)
+	if err != nil {
+		fmt.Printf("Load failover state error, %s.\n", err.Error())
+		os.Exit(1)
+	}
+	s.openAudit()
+	for _, v := range s.Config.Failover {
+		go s.watchFailover(v, store)
+	}
+	select {}
+}
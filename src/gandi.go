@@ -0,0 +1,136 @@
+package dnscli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const GandiAPIURL = "https://api.gandi.net/v5/livedns"
+
+type gandiRRset struct {
+	Name   string   `json:"rrset_name,omitempty"`
+	Type   string   `json:"rrset_type,omitempty"`
+	TTL    int      `json:"rrset_ttl,omitempty"`
+	Values []string `json:"rrset_values"`
+}
+
+type GandiProvider struct {
+	Endpoint string
+	Token    string
+	client   *restClient
+}
+
+func (s *GandiProvider) rrsetPath(Domain, Record, Type string) string {
+	return fmt.Sprintf("/domains/%s/records/%s/%s", url.PathEscape(defqdn(Domain)),
+		url.PathEscape(subName(Domain, Record, "@")), url.PathEscape(Type))
+}
+
+func (s *GandiProvider) toRecord(Domain string, v gandiRRset) DNSRecord {
+	return DNSRecord{absName(Domain, v.Name, "@"), v.Type, v.TTL, textDatas(v.Type, v.Values)}
+}
+
+func (s *GandiProvider) List(Domain string) ([]DNSRecord, error) {
+	result := make([]DNSRecord, 0)
+	const perPage = 100
+	for page := 1; ; page++ {
+		rrsets := make([]gandiRRset, 0)
+		header, err := s.client.do("GET", fmt.Sprintf("/domains/%s/records?page=%d&per_page=%d",
+			url.PathEscape(defqdn(Domain)), page, perPage), nil, &rrsets)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range rrsets {
+			result = append(result, s.toRecord(Domain, v))
+		}
+		if total, err := strconv.Atoi(header.Get("Total-Count")); err == nil {
+			if len(result) >= total {
+				return result, nil
+			}
+		} else if len(rrsets) < perPage {
+			return result, nil
+		}
+		if len(rrsets) == 0 {
+			return result, nil
+		}
+	}
+}
+
+func (s *GandiProvider) get(Domain, Record, Type string) (*DNSRecord, error) {
+	rrset := gandiRRset{}
+	if _, err := s.client.do("GET", s.rrsetPath(Domain, Record, Type), nil, &rrset); err != nil {
+		if isNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	record := s.toRecord(Domain, rrset)
+	return &record, nil
+}
+
+func (s *GandiProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *GandiProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.get(Domain, record.Name, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	body := gandiRRset{TTL: record.TTL, Values: zoneDatas(record)}
+	if _, err := s.client.do("PUT", s.rrsetPath(Domain, record.Name, record.Type), body, nil); err != nil {
+		return nil, err
+	}
+	recordChanges := &RecordChanges{Add: []DNSRecord{record}}
+	if old != nil {
+		recordChanges.Delete = []DNSRecord{*old}
+	}
+	return recordChanges, nil
+}
+
+func (s *GandiProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	old, err := s.get(Domain, Record, Type)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return nil, errors.New("records not found")
+	}
+	if _, err := s.client.do("DELETE", s.rrsetPath(Domain, Record, Type), nil, nil); err != nil {
+		return nil, err
+	}
+	return &RecordChanges{Delete: []DNSRecord{*old}}, nil
+}
+
+func (s *GandiProvider) Init() error {
+	if s.client != nil {
+		return nil
+	}
+	s.client = newRestClient(s.Endpoint, http.Header{
+		"Authorization": []string{"Bearer " + s.Token},
+	})
+	return nil
+}
+
+func init() {
+	RegisterProvider("Gandi", NewGandiProvider, "Token")
+}
+
+func NewGandiProvider(info map[string]string) (DNSProvider, error) {
+	p := &GandiProvider{Endpoint: GandiAPIURL}
+	if v, ok := info["Token"]; ok && v != "" {
+		p.Token = v
+	} else {
+		return nil, errors.New("gandi: Token not found")
+	}
+	if v, ok := info["Endpoint"]; ok && v != "" {
+		p.Endpoint = v
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+package dnscli
+
+import "testing"
+
+func TestGandiList(t *testing.T) {
+	p := fixtureProvider(t, "Gandi", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/records?page=1&per_page=100",
+			Header: map[string]string{"Total-Count": "3"},
+			Body: `[
+				{"rrset_name":"@","rrset_type":"MX","rrset_ttl":300,"rrset_values":["10 mx1.example.com.","20 mx2.example.com."]},
+				{"rrset_name":"www","rrset_type":"A","rrset_ttl":60,"rrset_values":["192.0.2.1"]}
+			]`,
+		},
+		{
+			Method: "GET", URI: "/domains/example.com/records?page=2&per_page=100",
+			Header: map[string]string{"Total-Count": "3"},
+			Body:   `[{"rrset_name":"www","rrset_type":"TXT","rrset_ttl":60,"rrset_values":["\"hello \" \"world\""]}]`,
+		},
+	})
+	records, err := p.List("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "records", records, []DNSRecord{
+		{"example.com.", "MX", 300, []string{"10 mx1.example.com.", "20 mx2.example.com."}},
+		{"www.example.com.", "A", 60, []string{"192.0.2.1"}},
+		{"www.example.com.", "TXT", 60, []string{"hello world"}},
+	})
+}
+
+func TestGandiPresent(t *testing.T) {
+	p := fixtureProvider(t, "Gandi", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/records/www/A",
+			Body: `{"rrset_name":"www","rrset_type":"A","rrset_ttl":60,"rrset_values":["192.0.2.1","192.0.2.2"]}`,
+		},
+		{
+			Method: "PUT", URI: "/domains/example.com/records/www/A",
+			Request: `{"rrset_ttl":300,"rrset_values":["192.0.2.9"]}`,
+			Status:  201,
+			Body:    `{"message":"DNS Record Created"}`,
+		},
+		{
+			Method: "GET", URI: "/domains/example.com/records/new/A",
+			Status: 404,
+			Body:   `{"code":404,"message":"Can't find the DNS record","object":"dns-record","cause":"Not Found"}`,
+		},
+		{
+			Method: "PUT", URI: "/domains/example.com/records/new/A",
+			Request: `{"rrset_ttl":300,"rrset_values":["192.0.2.10"]}`,
+			Status:  201,
+			Body:    `{"message":"DNS Record Created"}`,
+		},
+	})
+	changes, err := p.Present("example.com.", "www.example.com.", "A", "192.0.2.9", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.9"}}})
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2"}}})
+	changes, err = p.Present("example.com.", "new.example.com.", "A", "192.0.2.10", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "deleted", changes.Delete, nil)
+}
+
+func TestGandiAbsent(t *testing.T) {
+	p := fixtureProvider(t, "Gandi", []fixture{
+		{
+			Method: "GET", URI: "/domains/example.com/records/www/TXT",
+			Body: `{"rrset_name":"www","rrset_type":"TXT","rrset_ttl":60,"rrset_values":["\"hello\""]}`,
+		},
+		{Method: "DELETE", URI: "/domains/example.com/records/www/TXT", Status: 204},
+		{
+			Method: "GET", URI: "/domains/example.com/records/www/TXT",
+			Status: 404,
+			Body:   `{"code":404,"message":"Can't find the DNS record","object":"dns-record","cause":"Not Found"}`,
+		},
+	})
+	changes, err := p.Absent("example.com.", "www.example.com.", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "TXT", 60, []string{"hello"}}})
+	if _, err := p.Absent("example.com.", "www.example.com.", "TXT"); err == nil {
+		t.Error("absent of a missing RRset did not fail")
+	}
+}
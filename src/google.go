@@ -3,6 +3,7 @@ package dnscli
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"time"
@@ -60,16 +61,28 @@ func (s *GoogleProvider) parseChange(chg *dns.Change) *RecordChanges {
 	return &recordChanges
 }
 
+// listRRsets returns every RRset of the zone, following the pages of the
+// API.
+func (s *GoogleProvider) listRRsets(ZoneName string) ([]*dns.ResourceRecordSet, error) {
+	result := make([]*dns.ResourceRecordSet, 0)
+	err := s.client.ResourceRecordSets.List(s.project, ZoneName).Pages(context.Background(),
+		func(page *dns.ResourceRecordSetsListResponse) error {
+			result = append(result, page.Rrsets...)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (s *GoogleProvider) findDeleteRecords(ZoneName, Record, Type string) ([]*dns.ResourceRecordSet, error) {
-	recs, err := s.client.ResourceRecordSets.List(s.project, ZoneName).Do()
+	rrsets, err := s.listRRsets(ZoneName)
 	if err != nil {
 		return nil, err
 	}
 	deleteRecords := make([]*dns.ResourceRecordSet, 0)
-	if recs.Rrsets == nil {
-		return deleteRecords, nil
-	}
-	for _, v := range recs.Rrsets {
+	for _, v := range rrsets {
 		if v.Name == Record && v.Type == Type {
 			deleteRecords = append(deleteRecords, v)
 		}
@@ -77,42 +90,94 @@ func (s *GoogleProvider) findDeleteRecords(ZoneName, Record, Type string) ([]*dn
 	return deleteRecords, nil
 }
 
+func (s *GoogleProvider) toRecordSet(record DNSRecord) *dns.ResourceRecordSet {
+	datas := make([]string, 0, len(record.Datas))
+	for _, v := range record.Datas {
+		if record.Type == "CNAME" {
+			v = fqdn(v)
+		}
+		datas = append(datas, v)
+	}
+	return &dns.ResourceRecordSet{
+		Name:    fqdn(record.Name),
+		Rrdatas: datas,
+		Type:    record.Type,
+		Ttl:     int64(record.TTL),
+	}
+}
+
+func (s *GoogleProvider) commit(zoneName string, changes *dns.Change) (*RecordChanges, error) {
+	chg, err := s.client.Changes.Create(s.project, zoneName, changes).Do()
+	if err != nil {
+		return nil, err
+	}
+	for chg.Status == "pending" {
+		time.Sleep(1 * time.Second)
+		chg, err = s.client.Changes.Get(s.project, zoneName, chg.Id).Do()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.parseChange(chg), nil
+}
+
 func (s *GoogleProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *GoogleProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
 	zoneName := s.getZoneName(Domain)
 	if zoneName == "" {
 		return nil, errors.New("zone name not found")
 	}
-	if Type == "CNAME" {
-		Value = fqdn(Value)
-	}
-	rec := dns.ResourceRecordSet{
-		Name:    Record,
-		Rrdatas: []string{Value},
-		Type:    Type,
-		Ttl:     int64(TTL),
-	}
 	changes := &dns.Change{
-		Additions: []*dns.ResourceRecordSet{&rec},
+		Additions: []*dns.ResourceRecordSet{s.toRecordSet(record)},
 	}
-	deleteRecords, err := s.findDeleteRecords(zoneName, Record, Type)
+	deleteRecords, err := s.findDeleteRecords(zoneName, record.Name, record.Type)
 	if err != nil {
 		return nil, err
 	}
 	if len(deleteRecords) > 0 {
 		changes.Deletions = deleteRecords
 	}
-	chg, err := s.client.Changes.Create(s.project, zoneName, changes).Do()
+	return s.commit(zoneName, changes)
+}
+
+// ApplyChanges sends every RRset in a single Cloud DNS change, which the API
+// applies atomically.
+func (s *GoogleProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	zoneName := s.getZoneName(Domain)
+	if zoneName == "" {
+		return nil, errors.New("zone name not found")
+	}
+	rrsets, err := s.listRRsets(zoneName)
 	if err != nil {
 		return nil, err
 	}
-	for chg.Status == "pending" {
-		time.Sleep(1 * time.Second)
-		chg, err = s.client.Changes.Get(s.project, zoneName, chg.Id).Do()
+	change := &dns.Change{}
+	touched := make(map[string]bool)
+	for _, v := range changes.Add {
+		record, err := checkRecord(Domain, v)
 		if err != nil {
 			return nil, err
 		}
+		change.Additions = append(change.Additions, s.toRecordSet(record))
+		touched[rrsetKey(record)] = true
 	}
-	return s.parseChange(chg), nil
+	for _, v := range changes.Delete {
+		touched[rrsetKey(v)] = true
+	}
+	// Deletions must match the current content of the RRsets exactly.
+	for _, v := range rrsets {
+		if touched[rrsetKey(DNSRecord{Name: v.Name, Type: v.Type})] {
+			change.Deletions = append(change.Deletions, v)
+		}
+	}
+	return s.commit(zoneName, change)
 }
 
 func (s *GoogleProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
@@ -142,12 +207,12 @@ func (s *GoogleProvider) List(Domain string) ([]DNSRecord, error) {
 	if zoneName == "" {
 		return nil, errors.New("zone name not found")
 	}
-	recs, err := s.client.ResourceRecordSets.List(s.project, zoneName).Do()
+	rrsets, err := s.listRRsets(zoneName)
 	if err != nil {
 		return nil, err
 	}
 	result := make([]DNSRecord, 0)
-	for _, v := range recs.Rrsets {
+	for _, v := range rrsets {
 		result = append(result, DNSRecord{
 			v.Name, v.Type, int(v.Ttl), v.Rrdatas,
 		})
@@ -162,31 +227,36 @@ func (s *GoogleProvider) Init() error {
 	var err error
 	dat, err := ioutil.ReadFile(s.saFile)
 	if err != nil {
-		log.Fatalf("Unable to read Service Account file: %v", err)
+		return fmt.Errorf("unable to read Service Account file: %v", err)
 	}
 	conf, err := google.JWTConfigFromJSON(dat, dns.NdevClouddnsReadwriteScope)
 	if err != nil {
-		log.Fatalf("Unable to acquire config: %v", err)
+		return fmt.Errorf("unable to acquire config: %v", err)
 	}
 	client := conf.Client(context.Background())
 	s.client, err = dns.New(client)
 	if err != nil {
-		log.Fatalf("Unable to create Google Cloud DNS service: %v", err)
+		return fmt.Errorf("unable to create Google Cloud DNS service: %v", err)
 	}
+	s.inited = true
 	return nil
 }
 
-func NewGoogleProvider(info map[string]string) DNSProvider {
+func init() {
+	RegisterProvider("GoogleCloud", NewGoogleProvider, "Project", "SaFile")
+}
+
+func NewGoogleProvider(info map[string]string) (DNSProvider, error) {
 	project, ok := info["Project"]
 	if !ok || project == "" {
-		log.Fatal("Google Cloud project name missing")
+		return nil, errors.New("google cloud project name missing")
 	}
 	saFile, ok := info["SaFile"]
 	if !ok || saFile == "" {
-		log.Fatal("Google Cloud Service Account file missing")
+		return nil, errors.New("google cloud service account file missing")
 	}
 	return &GoogleProvider{
 		project: project,
 		saFile:  saFile,
-	}
+	}, nil
 }
@@ -0,0 +1,251 @@
+package dnscli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const HetznerAPIURL = "https://dns.hetzner.com/api/v1"
+
+type hetznerRecord struct {
+	ID     string `json:"id,omitempty"`
+	ZoneID string `json:"zone_id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	TTL    *int   `json:"ttl,omitempty"`
+}
+
+type hetznerMeta struct {
+	Pagination struct {
+		Page     int `json:"page"`
+		LastPage int `json:"last_page"`
+	} `json:"pagination"`
+}
+
+type HetznerProvider struct {
+	Endpoint string
+	Token    string
+	client   *restClient
+}
+
+func (s *HetznerProvider) zoneID(Domain string) (string, error) {
+	var rsp struct {
+		Zones []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"zones"`
+	}
+	_, err := s.client.do("GET", "/zones?name="+url.QueryEscape(defqdn(Domain)), nil, &rsp)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	for _, v := range rsp.Zones {
+		if sameName(v.Name, Domain) {
+			return v.ID, nil
+		}
+	}
+	return "", errors.New("zone not found")
+}
+
+func (s *HetznerProvider) records(zoneID string) ([]hetznerRecord, error) {
+	result := make([]hetznerRecord, 0)
+	for page := 1; ; page++ {
+		var rsp struct {
+			Records []hetznerRecord `json:"records"`
+			Meta    hetznerMeta     `json:"meta"`
+		}
+		_, err := s.client.do("GET", fmt.Sprintf("/records?zone_id=%s&page=%d&per_page=100",
+			url.QueryEscape(zoneID), page), nil, &rsp)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rsp.Records...)
+		if page >= rsp.Meta.Pagination.LastPage || len(rsp.Records) == 0 {
+			return result, nil
+		}
+	}
+}
+
+func (s *HetznerProvider) toRRsets(Domain string, records []hetznerRecord) []DNSRecord {
+	result := make([]DNSRecord, 0)
+	for _, v := range records {
+		ttl := 0
+		if v.TTL != nil {
+			ttl = *v.TTL
+		}
+		record := DNSRecord{absName(Domain, v.Name, "@"), v.Type, ttl, []string{v.Value}}
+		merged := false
+		for i := range result {
+			if sameRRset(result[i], record) {
+				result[i].Datas = append(result[i].Datas, v.Value)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+func (s *HetznerProvider) List(Domain string) ([]DNSRecord, error) {
+	id, err := s.zoneID(Domain)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.records(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toRRsets(Domain, records), nil
+}
+
+// rrsetRecords returns the records of the RRset of Record and Type.
+func (s *HetznerProvider) rrsetRecords(Domain, zoneID, Record, Type string) ([]hetznerRecord, error) {
+	records, err := s.records(zoneID)
+	if err != nil {
+		return nil, err
+	}
+	name := subName(Domain, Record, "@")
+	result := make([]hetznerRecord, 0)
+	for _, v := range records {
+		if strings.EqualFold(v.Name, name) && strings.EqualFold(v.Type, Type) {
+			result = append(result, v)
+		}
+	}
+	return result, nil
+}
+
+// deleteRecords removes records and returns the removed ones.
+func (s *HetznerProvider) deleteRecords(Domain string, records []hetznerRecord) ([]DNSRecord, error) {
+	deleted := make([]hetznerRecord, 0)
+	for _, v := range records {
+		if _, err := s.client.do("DELETE", "/records/"+url.PathEscape(v.ID), nil, nil); err != nil {
+			return s.toRRsets(Domain, deleted), err
+		}
+		deleted = append(deleted, v)
+	}
+	return s.toRRsets(Domain, deleted), nil
+}
+
+func (s *HetznerProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+// PresentRRset updates the records keeping their value and creates the new
+// ones before deleting the others, so a failure never leaves the RRset empty.
+func (s *HetznerProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	id, err := s.zoneID(Domain)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.rrsetRecords(Domain, id, record.Name, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	recordChanges := &RecordChanges{}
+	if len(existing) > 0 {
+		recordChanges.Delete = s.toRRsets(Domain, existing)
+	}
+	ttl := record.TTL
+	kept := make(map[string]bool)
+	body := struct {
+		Records []hetznerRecord `json:"records"`
+	}{}
+	for _, v := range record.Datas {
+		r := hetznerRecord{
+			ZoneID: id,
+			Name:   subName(Domain, record.Name, "@"),
+			Type:   record.Type,
+			Value:  v,
+			TTL:    &ttl,
+		}
+		found := false
+		for _, e := range existing {
+			if kept[e.ID] || e.Value != v {
+				continue
+			}
+			kept[e.ID], found = true, true
+			if e.TTL == nil || *e.TTL != ttl {
+				if _, err := s.client.do("PUT", "/records/"+url.PathEscape(e.ID), r, nil); err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+		if !found {
+			body.Records = append(body.Records, r)
+		}
+	}
+	if len(body.Records) > 0 {
+		if _, err := s.client.do("POST", "/records/bulk", body, nil); err != nil {
+			return nil, err
+		}
+	}
+	stale := make([]hetznerRecord, 0)
+	for _, v := range existing {
+		if !kept[v.ID] {
+			stale = append(stale, v)
+		}
+	}
+	if _, err := s.deleteRecords(Domain, stale); err != nil {
+		return nil, err
+	}
+	recordChanges.Add = []DNSRecord{record}
+	return recordChanges, nil
+}
+
+func (s *HetznerProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	id, err := s.zoneID(Domain)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.rrsetRecords(Domain, id, Record, Type)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.deleteRecords(Domain, records)
+	if err != nil {
+		return &RecordChanges{Delete: deleted}, err
+	}
+	if len(deleted) == 0 {
+		return nil, errors.New("records not found")
+	}
+	return &RecordChanges{Delete: deleted}, nil
+}
+
+func (s *HetznerProvider) Init() error {
+	if s.client != nil {
+		return nil
+	}
+	s.client = newRestClient(s.Endpoint, http.Header{
+		"Auth-Api-Token": []string{s.Token},
+	})
+	return nil
+}
+
+func init() {
+	RegisterProvider("Hetzner", NewHetznerProvider, "Token")
+}
+
+func NewHetznerProvider(info map[string]string) (DNSProvider, error) {
+	p := &HetznerProvider{Endpoint: HetznerAPIURL}
+	if v, ok := info["Token"]; ok && v != "" {
+		p.Token = v
+	} else {
+		return nil, errors.New("hetzner: Token not found")
+	}
+	if v, ok := info["Endpoint"]; ok && v != "" {
+		p.Endpoint = v
+	}
+	return p, nil
+}
@@ -0,0 +1,114 @@
+package dnscli
+
+import "testing"
+
+var hetznerZone = fixture{
+	Method: "GET", URI: "/zones?name=example.com",
+	Body: `{"zones":[{"id":"Z1","name":"example.com"}],"meta":{"pagination":{"page":1,"last_page":1}}}`,
+}
+
+func TestHetznerList(t *testing.T) {
+	p := fixtureProvider(t, "Hetzner", []fixture{
+		hetznerZone,
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=1&per_page=100",
+			Body: `{"records":[
+				{"id":"r1","zone_id":"Z1","name":"@","type":"A","value":"192.0.2.1","ttl":300},
+				{"id":"r2","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.2","ttl":60}
+			],"meta":{"pagination":{"page":1,"last_page":2}}}`,
+		},
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=2&per_page=100",
+			Body: `{"records":[
+				{"id":"r3","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.3","ttl":60}
+			],"meta":{"pagination":{"page":2,"last_page":2}}}`,
+		},
+	})
+	records, err := p.List("example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "records", records, []DNSRecord{
+		{"example.com.", "A", 300, []string{"192.0.2.1"}},
+		{"www.example.com.", "A", 60, []string{"192.0.2.2", "192.0.2.3"}},
+	})
+}
+
+func TestHetznerPresent(t *testing.T) {
+	p := fixtureProvider(t, "Hetzner", []fixture{
+		hetznerZone,
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=1&per_page=100",
+			Body: `{"records":[
+				{"id":"r2","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.2","ttl":60},
+				{"id":"r3","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.3","ttl":60},
+				{"id":"r4","zone_id":"Z1","name":"www","type":"TXT","value":"keep","ttl":60}
+			],"meta":{"pagination":{"page":1,"last_page":1}}}`,
+		},
+		{
+			Method: "PUT", URI: "/records/r2",
+			Request: `{"zone_id":"Z1","name":"www","type":"A","value":"192.0.2.2","ttl":300}`,
+			Body:    `{"record":{"id":"r2","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.2","ttl":300}}`,
+		},
+		{
+			Method: "POST", URI: "/records/bulk",
+			Request: `{"records":[{"zone_id":"Z1","name":"www","type":"A","value":"192.0.2.9","ttl":300}]}`,
+			Body:    `{"records":[{"id":"r5","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.9","ttl":300}]}`,
+		},
+		{Method: "DELETE", URI: "/records/r3"},
+	})
+	changes, err := p.(RRsetProvider).PresentRRset("example.com.",
+		DNSRecord{"www.example.com.", "A", 300, []string{"192.0.2.2", "192.0.2.9"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "added", changes.Add, []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.2", "192.0.2.9"}}})
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "A", 60, []string{"192.0.2.2", "192.0.2.3"}}})
+}
+
+func TestHetznerPresentKeepsRRsetOnError(t *testing.T) {
+	p := fixtureProvider(t, "Hetzner", []fixture{
+		hetznerZone,
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=1&per_page=100",
+			Body: `{"records":[
+				{"id":"r2","zone_id":"Z1","name":"www","type":"A","value":"192.0.2.2","ttl":60}
+			],"meta":{"pagination":{"page":1,"last_page":1}}}`,
+		},
+		{
+			Method: "POST", URI: "/records/bulk",
+			Request: `{"records":[{"zone_id":"Z1","name":"www","type":"A","value":"192.0.2.9","ttl":60}]}`,
+			Status:  422,
+			Body:    `{"error":{"message":"invalid record","code":422}}`,
+		},
+	})
+	if _, err := p.Present("example.com.", "www.example.com.", "A", "192.0.2.9", 60); err == nil {
+		t.Error("present did not fail")
+	}
+}
+
+func TestHetznerAbsent(t *testing.T) {
+	p := fixtureProvider(t, "Hetzner", []fixture{
+		hetznerZone,
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=1&per_page=100",
+			Body: `{"records":[
+				{"id":"r4","zone_id":"Z1","name":"www","type":"TXT","value":"hello","ttl":60}
+			],"meta":{"pagination":{"page":1,"last_page":1}}}`,
+		},
+		{Method: "DELETE", URI: "/records/r4"},
+		hetznerZone,
+		{
+			Method: "GET", URI: "/records?zone_id=Z1&page=1&per_page=100",
+			Body: `{"records":[],"meta":{"pagination":{"page":1,"last_page":1}}}`,
+		},
+	})
+	changes, err := p.Absent("example.com.", "www.example.com.", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRRsets(t, "deleted", changes.Delete, []DNSRecord{{"www.example.com.", "TXT", 60, []string{"hello"}}})
+	if _, err := p.Absent("example.com.", "www.example.com.", "TXT"); err == nil {
+		t.Error("absent of a missing RRset did not fail")
+	}
+}
@@ -2,7 +2,6 @@ package dnscli
 
 import (
 	"errors"
-	"log"
 	"strings"
 
 	"github.com/huaweicloud/huaweicloud-sdk-go-v3/core/auth/basic"
@@ -49,6 +48,15 @@ func (s *HuaweiProvider) List(Domain string) ([]DNSRecord, error) {
 }
 
 func (s *HuaweiProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *HuaweiProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	Record, Type, TTL := record.Name, record.Type, record.TTL
 	zone, err := s.client.ListPublicZones(&model.ListPublicZonesRequest{
 		Name: &Domain,
 	})
@@ -72,7 +80,6 @@ func (s *HuaweiProvider) Present(Domain, Record, Type, Value string, TTL int) (*
 				ZoneId:      *v.ZoneId,
 				RecordsetId: *v.Id,
 			})
-			log.Printf("delete")
 			if err != nil {
 				return recordChanges, err
 			}
@@ -91,14 +98,12 @@ func (s *HuaweiProvider) Present(Domain, Record, Type, Value string, TTL int) (*
 			Name:    Record,
 			Type:    Type,
 			Ttl:     &ttl,
-			Records: []string{Value},
+			Records: record.Datas,
 		}})
 	if err != nil {
 		return recordChanges, err
 	}
-	recordChanges.Add = []DNSRecord{{
-		Record, Type, TTL, []string{Value},
-	}}
+	recordChanges.Add = []DNSRecord{record}
 	return recordChanges, nil
 }
 
@@ -150,15 +155,18 @@ func (s *HuaweiProvider) Init() error {
 		dns.DnsClientBuilder().
 			WithRegion(region.ValueOf(s.Region)).
 			WithCredential(auth).Build())
-	if s.client != nil {
-		return nil
-	} else {
-		log.Fatal("Huawe provider init failed.")
-		return nil
+	if s.client == nil {
+		return errors.New("huawei provider init failed")
 	}
+	s.inited = true
+	return nil
+}
+
+func init() {
+	RegisterProvider("Huawei", NewHuaweiProvider, "AK", "SK")
 }
 
-func NewHuaweiProvider(info map[string]string) DNSProvider {
+func NewHuaweiProvider(info map[string]string) (DNSProvider, error) {
 	provider := HuaweiProvider{}
 	if v, ok := info["Endpoint"]; ok {
 		provider.Region = v
@@ -168,12 +176,12 @@ func NewHuaweiProvider(info map[string]string) DNSProvider {
 	if v, ok := info["AK"]; ok {
 		provider.AK = v
 	} else {
-		log.Fatal("Huawei: missing AK")
+		return nil, errors.New("huawei: missing AK")
 	}
 	if v, ok := info["SK"]; ok {
 		provider.SK = v
 	} else {
-		log.Fatal("Huawei: missing SK")
+		return nil, errors.New("huawei: missing SK")
 	}
-	return &provider
+	return &provider, nil
 }
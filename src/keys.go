@@ -0,0 +1,208 @@
+package dnscli
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// TsigKey is a TSIG key accepted by the daemon and what it may access.
+// Empty Zones, Names or Types do not restrict anything.
+type TsigKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+	// Zones are configured domains the key may use.
+	Zones []string
+	// Names are patterns matched against record names, "*" matches any
+	// string, dots included, e.g. "_acme-challenge.*".
+	Names []string
+	// Types are the record types the key may query or change.
+	Types  []string
+	Query  bool
+	Update bool
+}
+
+func (s *TsigKey) normalize() error {
+	if s.Name == "" {
+		return fmt.Errorf("tsig key name not set")
+	}
+	s.Name = dns.CanonicalName(s.Name)
+	if s.Secret == "" {
+		return fmt.Errorf("tsig key %s: secret not set", s.Name)
+	}
+	if s.Algorithm == "" {
+		s.Algorithm = "hmac-sha1"
+	}
+	alg, ok := tsigAlg[strings.TrimSuffix(strings.ToLower(s.Algorithm), ".")]
+	if !ok {
+		return fmt.Errorf("tsig key %s: algorithm %s not found", s.Name, s.Algorithm)
+	}
+	s.Algorithm = alg
+	return nil
+}
+
+func (s *TsigKey) allowZone(zone string) bool {
+	if len(s.Zones) == 0 {
+		return true
+	}
+	for _, v := range s.Zones {
+		if sameName(v, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TsigKey) allowName(name string) bool {
+	if len(s.Names) == 0 {
+		return true
+	}
+	name = strings.ToLower(defqdn(fqdn(name)))
+	for _, v := range s.Names {
+		if ok, _ := path.Match(strings.ToLower(defqdn(fqdn(v))), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowType tells whether rrtype may be used. ANY is only allowed to keys
+// without a Types restriction as it covers every type.
+func (s *TsigKey) allowType(rrtype uint16) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, v := range s.Types {
+		if strings.EqualFold(v, dns.TypeToString[rrtype]) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowRRs tells whether every RR of a prerequisite or update section is
+// allowed to the key.
+func (s *TsigKey) allowRRs(rrs []dns.RR) bool {
+	for _, rr := range rrs {
+		if !s.allowName(rr.Header().Name) || !s.allowType(rr.Header().Rrtype) {
+			return false
+		}
+	}
+	return true
+}
+
+// tsigKeys returns the keys in Keys plus the legacy Tsig one, which has
+// access to everything.
+func (s *Config) tsigKeys() (map[string]*TsigKey, error) {
+	result := make(map[string]*TsigKey)
+	if s.Tsig != "" {
+		alg, name, secret, err := s.parseTsig()
+		if err != nil {
+			return nil, err
+		}
+		result[dns.CanonicalName(name)] = &TsigKey{
+			Name:      dns.CanonicalName(name),
+			Algorithm: alg,
+			Secret:    secret,
+			Query:     true,
+			Update:    true,
+		}
+	}
+	for i := range s.Keys {
+		key := s.Keys[i]
+		if err := key.normalize(); err != nil {
+			return nil, err
+		}
+		if _, ok := result[key.Name]; ok {
+			return nil, fmt.Errorf("tsig key %s defined twice", key.Name)
+		}
+		result[key.Name] = &key
+	}
+	return result, nil
+}
+
+// keyring holds the keys of the daemon and is its dns.TsigProvider. Keys are
+// looked up on every message, so a reload applies to open connections too.
+type keyring struct {
+	lock sync.RWMutex
+	keys map[string]*TsigKey
+}
+
+func (s *keyring) set(keys map[string]*TsigKey) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.keys = keys
+}
+
+// get looks a key up by name, in the canonical form the names are stored in.
+func (s *keyring) get(name string) (*TsigKey, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key, ok := s.keys[dns.CanonicalName(name)]
+	return key, ok
+}
+
+func (s *keyring) count() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.keys)
+}
+
+// Generate returns the MAC of msg, the key must be used with the algorithm it
+// is configured with.
+func (s *keyring) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	key, ok := s.get(t.Hdr.Name)
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if !strings.EqualFold(dns.Fqdn(t.Algorithm), key.Algorithm) {
+		return nil, dns.ErrKeyAlg
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var h hash.Hash
+	switch key.Algorithm {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, secret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, secret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, secret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, secret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+func (s *keyring) Verify(msg []byte, t *dns.TSIG) error {
+	b, err := s.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(b, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package dnscli
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+type MemoryProvider struct {
+	lock  sync.RWMutex
+	zones map[string][]DNSRecord
+}
+
+func (s *MemoryProvider) zoneKey(Domain string) string {
+	return strings.ToLower(fqdn(Domain))
+}
+
+func (s *MemoryProvider) List(Domain string) ([]DNSRecord, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	records := s.zones[s.zoneKey(Domain)]
+	result := make([]DNSRecord, 0, len(records))
+	for _, v := range records {
+		result = append(result, copyRecord(v))
+	}
+	return result, nil
+}
+
+func (s *MemoryProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *MemoryProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	zone := s.zoneKey(Domain)
+	recordChanges := &RecordChanges{}
+	records := make([]DNSRecord, 0, len(s.zones[zone])+1)
+	for _, v := range s.zones[zone] {
+		if sameRRset(v, record) {
+			recordChanges.Delete = append(recordChanges.Delete, copyRecord(v))
+		} else {
+			records = append(records, v)
+		}
+	}
+	s.zones[zone] = append(records, record)
+	recordChanges.Add = []DNSRecord{copyRecord(record)}
+	return recordChanges, nil
+}
+
+// ApplyChanges replaces every RRset of changes under one lock.
+func (s *MemoryProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	add := make([]DNSRecord, 0, len(changes.Add))
+	for _, v := range changes.Add {
+		record, err := checkRecord(Domain, v)
+		if err != nil {
+			return nil, err
+		}
+		add = append(add, record)
+	}
+	touched := make(map[string]bool)
+	for _, v := range append(append([]DNSRecord{}, changes.Delete...), add...) {
+		touched[rrsetKey(v)] = true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	zone := s.zoneKey(Domain)
+	recordChanges := &RecordChanges{Add: add}
+	records := make([]DNSRecord, 0, len(s.zones[zone])+len(add))
+	for _, v := range s.zones[zone] {
+		if touched[rrsetKey(v)] {
+			recordChanges.Delete = append(recordChanges.Delete, copyRecord(v))
+		} else {
+			records = append(records, v)
+		}
+	}
+	for _, v := range add {
+		records = append(records, copyRecord(v))
+	}
+	s.zones[zone] = records
+	return recordChanges, nil
+}
+
+func (s *MemoryProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	zone := s.zoneKey(Domain)
+	target := DNSRecord{Name: Record, Type: Type}
+	recordChanges := &RecordChanges{}
+	records := make([]DNSRecord, 0, len(s.zones[zone]))
+	for _, v := range s.zones[zone] {
+		if sameRRset(v, target) {
+			recordChanges.Delete = append(recordChanges.Delete, copyRecord(v))
+		} else {
+			records = append(records, v)
+		}
+	}
+	if len(recordChanges.Delete) == 0 {
+		return nil, errors.New("records not found")
+	}
+	s.zones[zone] = records
+	return recordChanges, nil
+}
+
+func (s *MemoryProvider) Init() error {
+	return nil
+}
+
+func init() {
+	RegisterProvider("InMemory", NewMemoryProvider)
+}
+
+// NewMemoryProvider returns an empty provider keeping every zone in memory.
+// Nothing is persisted, which makes it suitable for tests and dry runs.
+func NewMemoryProvider(info map[string]string) (DNSProvider, error) {
+	return &MemoryProvider{
+		zones: make(map[string][]DNSRecord),
+	}, nil
+}
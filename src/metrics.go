@@ -0,0 +1,409 @@
+package dnscli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the provider call
+// latency histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func labelString(names []string, values []string) string {
+	pairs := make([]string, len(names))
+	for i := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, names[i], v)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// counterVec is a counter per set of label values.
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	lock   sync.Mutex
+	values map[string]uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]uint64)}
+}
+
+func (s *counterVec) inc(values ...string) {
+	key := labelString(s.labels, values)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.values[key]++
+}
+
+func (s *counterVec) write(w io.Writer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", s.name, s.help, s.name)
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %d\n", s.name, k, s.values[k])
+	}
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a histogram of durationBuckets per set of label values.
+type histogramVec struct {
+	name   string
+	help   string
+	labels []string
+	lock   sync.Mutex
+	values map[string]*histogram
+}
+
+func newHistogramVec(name, help string, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, values: make(map[string]*histogram)}
+}
+
+func (s *histogramVec) observe(seconds float64, values ...string) {
+	key := labelString(s.labels, values)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	h, ok := s.values[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		s.values[key] = h
+	}
+	for i, v := range durationBuckets {
+		if seconds <= v {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+func (s *histogramVec) write(w io.Writer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", s.name, s.help, s.name)
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h := s.values[k]
+		labels := strings.TrimSuffix(k, "}")
+		if labels != "{" {
+			labels += ","
+		}
+		for i, v := range durationBuckets {
+			fmt.Fprintf(w, "%s_bucket%sle=\"%g\"} %d\n", s.name, labels, v, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%sle=\"+Inf\"} %d\n", s.name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum%s %g\n", s.name, k, h.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", s.name, k, h.count)
+	}
+}
+
+// metrics are the counters the daemon exposes in the Prometheus text format.
+// They live as long as the process, across config reloads.
+type metrics struct {
+	tsigFailures     uint64
+	requests         *counterVec
+	providerCalls    *counterVec
+	providerErrors   *counterVec
+	providerDuration *histogramVec
+	replicaErrors    *counterVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: newCounterVec("dnscli_requests_total",
+			"DNS requests answered, by zone, opcode and rcode.", "zone", "opcode", "rcode"),
+		providerCalls: newCounterVec("dnscli_provider_calls_total",
+			"Provider calls, by provider type and method.", "provider", "method"),
+		providerErrors: newCounterVec("dnscli_provider_errors_total",
+			"Failed provider calls, by provider type and method.", "provider", "method"),
+		providerDuration: newHistogramVec("dnscli_provider_call_duration_seconds",
+			"Provider call latency, by provider type and method.", "provider", "method"),
+		replicaErrors: newCounterVec("dnscli_replica_errors_total",
+			"Changes a replica failed to mirror, by replica provider.", "replica"),
+	}
+}
+
+func (s *metrics) request(zone string, opcode, rcode int) {
+	s.requests.inc(zone, dns.OpcodeToString[opcode], dns.RcodeToString[rcode])
+}
+
+func (s *metrics) tsigFailure() {
+	atomic.AddUint64(&s.tsigFailures, 1)
+}
+
+func (s *metrics) providerCall(providerType, method string, start time.Time, err error) {
+	s.providerCalls.inc(providerType, method)
+	if err != nil {
+		s.providerErrors.inc(providerType, method)
+	}
+	s.providerDuration.observe(time.Since(start).Seconds(), providerType, method)
+}
+
+func (s *metrics) replicaError(name string) {
+	s.replicaErrors.inc(name)
+}
+
+func (s *metrics) write(w io.Writer, cache *zoneCache) {
+	s.requests.write(w)
+	fmt.Fprintf(w, "# HELP dnscli_tsig_failures_total Requests with an unknown key or a bad TSIG.\n")
+	fmt.Fprintf(w, "# TYPE dnscli_tsig_failures_total counter\n")
+	fmt.Fprintf(w, "dnscli_tsig_failures_total %d\n", atomic.LoadUint64(&s.tsigFailures))
+	s.providerCalls.write(w)
+	s.providerErrors.write(w)
+	s.providerDuration.write(w)
+	s.replicaErrors.write(w)
+	hits, misses := cache.stats()
+	fmt.Fprintf(w, "# HELP dnscli_cache_hits_total Zone listings served from the cache since the last reload.\n")
+	fmt.Fprintf(w, "# TYPE dnscli_cache_hits_total counter\n")
+	fmt.Fprintf(w, "dnscli_cache_hits_total %d\n", hits)
+	fmt.Fprintf(w, "# HELP dnscli_cache_misses_total Zone listings read from the provider since the last reload.\n")
+	fmt.Fprintf(w, "# TYPE dnscli_cache_misses_total counter\n")
+	fmt.Fprintf(w, "dnscli_cache_misses_total %d\n", misses)
+}
+
+// instrumentedProvider records the calls of a provider in metrics. It always
+// implements RRsetProvider and ChangeApplier, the wrapped provider falls back
+// like presentRRset and applyChanges do. Replica failures are counted apart,
+// not as errors of the provider.
+type instrumentedProvider struct {
+	DNSProvider
+	providerType string
+	metrics      *metrics
+	initLock     sync.Mutex
+	initErr      error
+}
+
+func (s *instrumentedProvider) Init() error {
+	s.initLock.Lock()
+	defer s.initLock.Unlock()
+	return s.init()
+}
+
+func (s *instrumentedProvider) init() error {
+	start := time.Now()
+	s.initErr = s.DNSProvider.Init()
+	s.metrics.providerCall(s.providerType, "Init", start, s.initErr)
+	return s.initErr
+}
+
+// retryInit initialises the provider again when that failed before.
+func (s *instrumentedProvider) retryInit() error {
+	s.initLock.Lock()
+	defer s.initLock.Unlock()
+	if s.initErr == nil {
+		return nil
+	}
+	return s.init()
+}
+
+func (s *instrumentedProvider) List(Domain string) ([]DNSRecord, error) {
+	start := time.Now()
+	result, err := s.DNSProvider.List(Domain)
+	s.metrics.providerCall(s.providerType, "List", start, err)
+	return result, err
+}
+
+func (s *instrumentedProvider) Present(Domain, record, recordType, recordValue string, recordTTL int) (*RecordChanges, error) {
+	start := time.Now()
+	result, err := s.DNSProvider.Present(Domain, record, recordType, recordValue, recordTTL)
+	s.metrics.providerCall(s.providerType, "Present", start, primaryError(err))
+	return result, err
+}
+
+func (s *instrumentedProvider) Absent(Domain, record, recordType string) (*RecordChanges, error) {
+	start := time.Now()
+	result, err := s.DNSProvider.Absent(Domain, record, recordType)
+	s.metrics.providerCall(s.providerType, "Absent", start, primaryError(err))
+	return result, err
+}
+
+func (s *instrumentedProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	start := time.Now()
+	result, err := presentRRset(s.DNSProvider, Domain, record)
+	s.metrics.providerCall(s.providerType, "PresentRRset", start, primaryError(err))
+	return result, err
+}
+
+func (s *instrumentedProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	start := time.Now()
+	result, err := applyChanges(s.DNSProvider, Domain, changes)
+	s.metrics.providerCall(s.providerType, "ApplyChanges", start, primaryError(err))
+	return result, err
+}
+
+// instrument wraps every provider in instrumentedProvider, a provider serving
+// several domains is wrapped once.
+func (s *Cli) instrument() {
+	wrapped := make(map[DNSProvider]DNSProvider)
+	for k, v := range s.Config.Domains {
+		zone := dns.Fqdn(k)
+		p, ok := s.dnsProviders[zone]
+		if !ok {
+			continue
+		}
+		if _, ok := wrapped[p]; !ok {
+			if r, ok := p.(*replicatedProvider); ok {
+				r.metrics = s.metrics
+			}
+			wrapped[p] = &instrumentedProvider{DNSProvider: p, providerType: s.Config.Providers[v.Provider]["Type"], metrics: s.metrics}
+		}
+		s.dnsProviders[zone] = wrapped[p]
+	}
+}
+
+// healthTimeout bounds how long /healthz and /readyz wait for a provider.
+const healthTimeout = 10 * time.Second
+
+// healthCheck is one line of the /healthz or /readyz report.
+type healthCheck struct {
+	name  string
+	check func() error
+}
+
+// checkProvider initialises p again if it failed to and lists zone without
+// the cache.
+func checkProvider(p DNSProvider, zone string) error {
+	if v, ok := p.(*instrumentedProvider); ok {
+		if err := v.retryInit(); err != nil {
+			return err
+		}
+	}
+	_, err := p.List(zone)
+	return err
+}
+
+// providerChecks returns a check of every configured provider, with one of
+// its zones, named after the provider.
+func (s *Cli) providerChecks() []healthCheck {
+	zones := make(map[string]string)
+	for k, v := range s.Config.Domains {
+		zone := dns.Fqdn(k)
+		if _, ok := s.dnsProviders[zone]; !ok {
+			continue
+		}
+		if z, ok := zones[v.Provider]; !ok || zone < z {
+			zones[v.Provider] = zone
+		}
+	}
+	names := make([]string, 0, len(zones))
+	for k := range zones {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	checks := make([]healthCheck, 0, len(names))
+	for _, name := range names {
+		zone := zones[name]
+		p := s.dnsProviders[zone]
+		checks = append(checks, healthCheck{name, func() error { return checkProvider(p, zone) }})
+	}
+	return checks
+}
+
+// zoneChecks returns a check listing every zone through the cache.
+func (s *Cli) zoneChecks() []healthCheck {
+	zones := make([]string, 0, len(s.dnsProviders))
+	for k := range s.dnsProviders {
+		zones = append(zones, k)
+	}
+	sort.Strings(zones)
+	cache := s.cache
+	checks := make([]healthCheck, 0, len(zones))
+	for _, zone := range zones {
+		zone, p := zone, s.dnsProviders[zone]
+		checks = append(checks, healthCheck{zone, func() error {
+			_, err := cache.list(zone, p)
+			return err
+		}})
+	}
+	return checks
+}
+
+// runChecks runs every check at once, giving up on each after healthTimeout,
+// and reports them in order.
+func runChecks(checks []healthCheck, report io.Writer) bool {
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, check func() error) {
+			defer wg.Done()
+			errc := make(chan error, 1)
+			go func() { errc <- check() }()
+			select {
+			case errs[i] = <-errc:
+			case <-time.After(healthTimeout):
+				errs[i] = fmt.Errorf("no answer in %s", healthTimeout)
+			}
+		}(i, c.check)
+	}
+	wg.Wait()
+	failed := false
+	for i, c := range checks {
+		failed = failed || errs[i] != nil
+		fmt.Fprintf(report, "%s %s\n", c.name, statusOf(errs[i]))
+	}
+	return failed
+}
+
+// serveMetrics serves /metrics, /healthz, which checks every provider, and
+// /readyz, which lists every zone through the cache.
+func (s *Cli) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	// The checks are built under reloadLock and run without it, a reload
+	// must not wait for slow providers.
+	var checks []healthCheck
+	s.reloadLock.RLock()
+	metrics, cache := s.metrics, s.cache
+	switch r.URL.Path {
+	case "/healthz":
+		checks = s.providerChecks()
+	case "/readyz":
+		checks = s.zoneChecks()
+	}
+	s.reloadLock.RUnlock()
+	switch r.URL.Path {
+	case "/metrics":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.write(w, cache)
+		return
+	case "/healthz", "/readyz":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	report := new(strings.Builder)
+	if runChecks(checks, report) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	io.WriteString(w, report.String())
+}
+
+func statusOf(err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return "ok"
+}
@@ -0,0 +1,58 @@
+package dnscli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingProvider signals listing and blocks until release is closed.
+type blockingProvider struct {
+	*MemoryProvider
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingProvider) List(Domain string) ([]DNSRecord, error) {
+	s.listing <- struct{}{}
+	<-s.release
+	return s.MemoryProvider.List(Domain)
+}
+
+func TestServeMetricsChecks(t *testing.T) {
+	for _, path := range []string{"/healthz", "/readyz"} {
+		p := &blockingProvider{&MemoryProvider{zones: make(map[string][]DNSRecord)}, make(chan struct{}, 1), make(chan struct{})}
+		s := &Cli{
+			Config:       Config{Domains: map[string]DomainConfig{"example.com": {Provider: "Memory"}}},
+			dnsProviders: map[string]DNSProvider{"example.com.": p},
+			cache:        newZoneCache(0),
+			metrics:      newMetrics(),
+		}
+		done := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w := httptest.NewRecorder()
+			s.serveMetrics(w, httptest.NewRequest("GET", path, nil))
+			done <- w
+		}()
+		<-p.listing
+		// A reload takes reloadLock while the provider is still checked.
+		locked := make(chan struct{})
+		go func() {
+			s.reloadLock.Lock()
+			s.reloadLock.Unlock()
+			close(locked)
+		}()
+		select {
+		case <-locked:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s holds reloadLock while checking", path)
+		}
+		close(p.release)
+		w := <-done
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), " ok\n") {
+			t.Errorf("%s answered %d %q", path, w.Code, w.Body.String())
+		}
+	}
+}
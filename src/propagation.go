@@ -0,0 +1,218 @@
+package dnscli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/olekukonko/tablewriter"
+)
+
+// propagationInterval is the delay between two rounds of queries to the
+// authoritative nameservers.
+const propagationInterval = 5 * time.Second
+
+// nameservers returns the addresses of every nameserver of zone, by name. A
+// nameserver whose name does not resolve is kept without address.
+func nameservers(zone string) (map[string][]string, error) {
+	ns, err := net.LookupNS(zone)
+	if err != nil {
+		return nil, fmt.Errorf("lookup nameservers of %s error, %s", zone, err)
+	}
+	result := make(map[string][]string)
+	for _, v := range ns {
+		addrs, _ := net.LookupHost(v.Host)
+		result[fqdn(v.Host)] = addrs
+	}
+	return result, nil
+}
+
+// queryNameserver asks a nameserver, at the first of addrs which answers,
+// for the RRset of name and qtype. A missing name or RRset has no value.
+func queryNameserver(addrs []string, name string, qtype uint16) ([]string, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(fqdn(name), qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(1232, false)
+	err := errors.New("no address")
+	for _, addr := range addrs {
+		c := &dns.Client{Timeout: 5 * time.Second}
+		var r *dns.Msg
+		r, _, err = c.Exchange(m, net.JoinHostPort(addr, "53"))
+		if err == nil && r.Truncated {
+			c.Net = "tcp"
+			r, _, err = c.Exchange(m, net.JoinHostPort(addr, "53"))
+		}
+		if err != nil {
+			continue
+		}
+		if r.Rcode != dns.RcodeSuccess && r.Rcode != dns.RcodeNameError {
+			err = fmt.Errorf("answered %s", dns.RcodeToString[r.Rcode])
+			continue
+		}
+		if !r.Authoritative {
+			err = errors.New("not authoritative")
+			continue
+		}
+		datas := make([]string, 0)
+		for _, v := range r.Answer {
+			if sameName(v.Header().Name, name) && v.Header().Rrtype == qtype {
+				datas = append(datas, rr2Record(v).Datas...)
+			}
+		}
+		return datas, nil
+	}
+	return nil, err
+}
+
+// nameserverStatus is the last answer of a nameserver while waiting.
+type nameserverStatus struct {
+	Name  string
+	Datas []string
+	Err   error
+	Done  bool
+}
+
+// waitNameservers queries every nameserver of zone for name and qtype until
+// done accepts all their answers, or timeout passes. A timeout of 0 queries
+// them once.
+func waitNameservers(zone, name string, qtype uint16, done func([]string) bool, timeout time.Duration) ([]nameserverStatus, error) {
+	servers, err := nameservers(zone)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]nameserverStatus, 0, len(servers))
+	for k := range servers {
+		statuses = append(statuses, nameserverStatus{Name: k})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := make([]string, 0)
+		for i := range statuses {
+			status := &statuses[i]
+			if status.Done {
+				continue
+			}
+			status.Datas, status.Err = queryNameserver(servers[status.Name], name, qtype)
+			status.Done = status.Err == nil && done(status.Datas)
+			if !status.Done {
+				pending = append(pending, defqdn(status.Name))
+			}
+		}
+		if len(pending) == 0 {
+			return statuses, nil
+		}
+		if !time.Now().Before(deadline) {
+			err := fmt.Errorf("%s not served by %s", defqdn(name), strings.Join(pending, ", "))
+			if timeout > 0 {
+				err = fmt.Errorf("%s after %s", err, timeout)
+			}
+			return statuses, err
+		}
+		time.Sleep(propagationInterval)
+	}
+}
+
+func printNameservers(statuses []nameserverStatus) {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Nameserver", "Status", "Value"})
+	table.SetAutoWrapText(false)
+	for _, v := range statuses {
+		status := "ok"
+		if v.Err != nil {
+			status = "error: " + v.Err.Error()
+		} else if !v.Done {
+			status = "differs"
+		}
+		value := strings.Join(v.Datas, " ")
+		if len(value) > 48 {
+			value = value[:48] + string("...")
+		}
+		table.Append([]string{v.Name, status, value})
+	}
+	table.Render()
+}
+
+// normalizeDatas returns the values of an RRset as rr2Record reads them
+// from answers, so provider values and answers compare equal.
+func normalizeDatas(name, recordType string, datas []string) []string {
+	result := make([]string, 0, len(datas))
+	for _, v := range datas {
+		rrs, err := DNSRecord2RR(DNSRecord{Name: name, Type: recordType, Datas: []string{v}})
+		if err == nil && len(rrs) == 1 {
+			v = rr2Record(rrs[0]).Datas[0]
+		}
+		if !strings.EqualFold(recordType, "TXT") {
+			v = strings.ToLower(v)
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// listRRset returns the values of the RRset of name and recordType held by
+// the provider.
+func listRRset(p DNSProvider, zone, name, recordType string) ([]string, error) {
+	records, err := p.List(zone)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range groupRRsets(records) {
+		if sameRRset(v, DNSRecord{Name: name, Type: recordType}) {
+			return v.Datas, nil
+		}
+	}
+	return nil, nil
+}
+
+// checkNameservers compares the RRset of name and recordType served by
+// every nameserver of zone with the one held by the provider, waiting for
+// them to match when s.wait is set, and prints the status of each.
+func (s *Cli) checkNameservers(p DNSProvider, zone, name, recordType string) error {
+	qtype, ok := dns.StringToType[strings.ToUpper(recordType)]
+	if !ok {
+		return fmt.Errorf("unknown record type %s", recordType)
+	}
+	expected, err := listRRset(p, zone, name, recordType)
+	if err != nil {
+		return err
+	}
+	expected = normalizeDatas(name, recordType, expected)
+	timeout := time.Duration(0)
+	if s.wait {
+		timeout = time.Duration(s.Config.PropagationTimeout) * time.Second
+	}
+	statuses, err := waitNameservers(zone, name, qtype, func(datas []string) bool {
+		return sameDatas(normalizeDatas(name, recordType, datas), expected)
+	}, timeout)
+	if statuses != nil {
+		printNameservers(statuses)
+	}
+	return err
+}
+
+// CheckRecord runs `dns check <name> <type>`.
+func (s *Cli) CheckRecord(args []string) {
+	if len(args) <= 1 {
+		fmt.Println("Please input record and type.")
+		os.Exit(1)
+	}
+	record := dns.Fqdn(args[0])
+	domain := s.findDomain(record)
+	if domain == "" {
+		fmt.Println("Domain not found")
+		os.Exit(1)
+	}
+	provider := s.initProvider(domain)
+	if err := s.checkNameservers(provider, domain, record, args[1]); err != nil {
+		fmt.Printf("Check error, %s.\n", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("Served by every nameserver.\n")
+}
@@ -1,5 +1,7 @@
 package dnscli
 
+import "errors"
+
 type DNSRecord struct {
 	Name  string
 	Type  string
@@ -18,3 +20,21 @@ type DNSProvider interface {
 	Present(Domain, record, recordType, recordValue string, recordTTL int) (*RecordChanges, error)
 	Absent(Domain, record, recordType string) (*RecordChanges, error)
 }
+
+// RRsetProvider is implemented by providers which can replace a whole RRset,
+// with every value in record.Datas, in a single call.
+type RRsetProvider interface {
+	PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error)
+}
+
+// presentRRset replaces the RRset through PresentRRset when the provider
+// supports it, RRsets of a single value fall back to Present.
+func presentRRset(p DNSProvider, Domain string, record DNSRecord) (*RecordChanges, error) {
+	if v, ok := p.(RRsetProvider); ok {
+		return v.PresentRRset(Domain, record)
+	}
+	if len(record.Datas) != 1 {
+		return nil, errors.New("provider can not set RRsets with several values")
+	}
+	return p.Present(Domain, record.Name, record.Type, record.Datas[0], record.TTL)
+}
@@ -0,0 +1,166 @@
+package dnscli
+
+import (
+	"log"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds how many CNAMEs are followed inside a zone.
+const maxCNAMEChain = 8
+
+// rrsAt returns the RRs owned by name.
+func rrsAt(rrs []dns.RR, name string) []dns.RR {
+	result := make([]dns.RR, 0)
+	for _, v := range rrs {
+		if sameName(v.Header().Name, name) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// nameExists tells whether name owns RRs or is an empty non-terminal, a name
+// without RRs but with descendants, RFC 4592 §2.2.2.
+func nameExists(rrs []dns.RR, name string) bool {
+	for _, v := range rrs {
+		if dns.IsSubDomain(name, v.Header().Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findCut returns the NS RRset of the delegation below zone covering name,
+// or nil when the zone is authoritative for name. DS records live on the
+// parent side of the cut, RFC 4035 §3.1.4.1.
+func findCut(zone string, rrs []dns.RR, name string, qtype uint16) []dns.RR {
+	labels := dns.SplitDomainName(name)
+	for i := len(labels) - dns.CountLabel(zone) - 1; i >= 0; i-- {
+		if i == 0 && qtype == dns.TypeDS {
+			break
+		}
+		if ns := rrsetOf(rrs, strings.Join(labels[i:], ".")+".", dns.TypeNS); len(ns) > 0 {
+			return ns
+		}
+	}
+	return nil
+}
+
+// glueOf returns the in zone addresses of the name servers in ns.
+func glueOf(zone string, rrs []dns.RR, ns []dns.RR) []dns.RR {
+	result := make([]dns.RR, 0)
+	for _, v := range ns {
+		target := v.(*dns.NS).Ns
+		if !dns.IsSubDomain(zone, target) {
+			continue
+		}
+		result = append(result, rrsetOf(rrs, target, dns.TypeA)...)
+		result = append(result, rrsetOf(rrs, target, dns.TypeAAAA)...)
+	}
+	return result
+}
+
+// expandWildcard returns the RRs of the wildcard matching name, with name as
+// owner, RFC 4592 §3.3. name must not exist in the zone.
+func expandWildcard(zone string, rrs []dns.RR, name string) []dns.RR {
+	labels := dns.SplitDomainName(name)
+	for i := 1; i < len(labels)-dns.CountLabel(zone)+1; i++ {
+		encloser := strings.Join(labels[i:], ".") + "."
+		if !nameExists(rrs, encloser) {
+			continue
+		}
+		// Only the closest encloser may hold the wildcard.
+		result := make([]dns.RR, 0)
+		for _, v := range rrsAt(rrs, "*."+encloser) {
+			rr := dns.Copy(v)
+			rr.Header().Name = name
+			result = append(result, rr)
+		}
+		return result
+	}
+	return nil
+}
+
+// negativeSOA is the SOA put in the authority section of NXDOMAIN and NODATA
+// answers, its TTL bounds negative caching, RFC 2308 §3.
+func negativeSOA(soa *dns.SOA) dns.RR {
+	result := dns.Copy(soa).(*dns.SOA)
+	if result.Minttl < result.Hdr.Ttl {
+		result.Hdr.Ttl = result.Minttl
+	}
+	return result
+}
+
+// answerQuery looks name and qtype up in rrs, the content of zone, RFC 1034
+// §4.3.2. CNAMEs are followed as long as their target is in the zone and
+// allowed to key.
+func answerQuery(m *dns.Msg, zone string, rrs []dns.RR, soa *dns.SOA, name string, qtype uint16, key *TsigKey) {
+	m.Authoritative = true
+	for i := 0; i <= maxCNAMEChain; i++ {
+		if ns := findCut(zone, rrs, name, qtype); ns != nil {
+			// A referral is not authoritative, unless a CNAME led to it.
+			m.Authoritative = len(m.Answer) > 0
+			m.Ns = ns
+			m.Extra = glueOf(zone, rrs, ns)
+			return
+		}
+		node := rrsAt(rrs, name)
+		if len(node) == 0 && !nameExists(rrs, name) {
+			node = expandWildcard(zone, rrs, name)
+			if len(node) == 0 {
+				m.Rcode = dns.RcodeNameError
+				m.Ns = []dns.RR{negativeSOA(soa)}
+				return
+			}
+		}
+		if cname := rrsetOf(node, name, dns.TypeCNAME); len(cname) > 0 && qtype != dns.TypeCNAME && qtype != dns.TypeANY {
+			m.Answer = append(m.Answer, cname...)
+			target := cname[0].(*dns.CNAME).Target
+			if !dns.IsSubDomain(zone, target) || !key.allowName(target) {
+				return
+			}
+			name = target
+			continue
+		}
+		answer := make([]dns.RR, 0)
+		for _, v := range node {
+			if qtype == dns.TypeANY || v.Header().Rrtype == qtype {
+				answer = append(answer, v)
+			}
+		}
+		if len(answer) == 0 {
+			m.Ns = []dns.RR{negativeSOA(soa)}
+		}
+		m.Answer = append(m.Answer, answer...)
+		return
+	}
+	log.Printf("CNAME chain of %s too long", name)
+	m.Rcode = dns.RcodeServerFailure
+}
+
+func (s *Cli) handleQuery(r *dns.Msg, m *dns.Msg, key *TsigKey) {
+	if len(r.Question) != 1 {
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		return
+	}
+	q := r.Question[0]
+	domain := s.findDomain(q.Name)
+	if domain == "" || (q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY) {
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+	if !key.Query || !key.allowZone(domain) || !key.allowName(q.Name) || !key.allowType(q.Qtype) {
+		m.SetRcode(r, dns.RcodeRefused)
+		return
+	}
+	rrs, soa, err := s.zoneContent(domain)
+	if err != nil {
+		log.Print(err)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return
+	}
+	m.SetRcode(r, dns.RcodeSuccess)
+	answerQuery(m, domain, append([]dns.RR{soa}, rrs...), soa, q.Name, q.Qtype, key)
+}
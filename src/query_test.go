@@ -0,0 +1,66 @@
+package dnscli
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestHandleQueryZone(t *testing.T) {
+	parent := &MemoryProvider{zones: make(map[string][]DNSRecord)}
+	child := &MemoryProvider{zones: make(map[string][]DNSRecord)}
+	for _, c := range []struct {
+		P      *MemoryProvider
+		Zone   string
+		Record DNSRecord
+	}{
+		{parent, "example.com.", DNSRecord{"www.example.com.", "A", 300, []string{"192.0.2.1"}}},
+		{parent, "example.com.", DNSRecord{"www.sub.example.com.", "A", 300, []string{"192.0.2.2"}}},
+		{child, "sub.example.com.", DNSRecord{"www.sub.example.com.", "A", 300, []string{"192.0.2.3"}}},
+	} {
+		if _, err := c.P.PresentRRset(c.Zone, c.Record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Cli{
+		dnsProviders: map[string]DNSProvider{"example.com.": parent, "sub.example.com.": child},
+		cache:        newZoneCache(0),
+	}
+	key := &TsigKey{Query: true}
+	for _, c := range []struct {
+		Name   string
+		Zone   string
+		Rcode  int
+		Answer string
+	}{
+		{"www.example.com.", "example.com.", dns.RcodeSuccess, "192.0.2.1"},
+		{"WWW.Example.COM.", "example.com.", dns.RcodeSuccess, "192.0.2.1"},
+		{"www.sub.example.com.", "sub.example.com.", dns.RcodeSuccess, "192.0.2.3"},
+		{"ftp.example.com.", "example.com.", dns.RcodeNameError, ""},
+		{"www.badexample.com.", "", dns.RcodeRefused, ""},
+		{"example.com.example.net.", "", dns.RcodeRefused, ""},
+		{"com.", "", dns.RcodeRefused, ""},
+	} {
+		if zone := s.findDomain(c.Name); zone != c.Zone {
+			t.Errorf("zone of %s is %q, want %q", c.Name, zone, c.Zone)
+		}
+		r := new(dns.Msg)
+		r.SetQuestion(c.Name, dns.TypeA)
+		m := new(dns.Msg)
+		m.SetReply(r)
+		s.handleQuery(r, m, key)
+		if m.Rcode != c.Rcode {
+			t.Errorf("%s: rcode %s, want %s", c.Name, dns.RcodeToString[m.Rcode], dns.RcodeToString[c.Rcode])
+			continue
+		}
+		if c.Answer == "" {
+			if len(m.Answer) != 0 {
+				t.Errorf("%s: answer %v", c.Name, m.Answer)
+			}
+			continue
+		}
+		if len(m.Answer) != 1 || m.Answer[0].(*dns.A).A.String() != c.Answer {
+			t.Errorf("%s: answer %v, want %s", c.Name, m.Answer, c.Answer)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package dnscli
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ProviderFactory builds a provider from its entry in Config.Providers.
+type ProviderFactory func(info map[string]string) (DNSProvider, error)
+
+type providerType struct {
+	Name     string
+	Required []string
+	factory  ProviderFactory
+}
+
+var (
+	providerTypesLock sync.RWMutex
+	providerTypes     = make(map[string]providerType)
+)
+
+// RegisterProvider makes typeName usable as "Type" in config.json.
+// requiredKeys are checked before factory is called. It is meant to be called
+// from init(), registering the same type twice panics.
+func RegisterProvider(typeName string, factory ProviderFactory, requiredKeys ...string) {
+	providerTypesLock.Lock()
+	defer providerTypesLock.Unlock()
+	if factory == nil {
+		panic("dnscli: RegisterProvider factory is nil for " + typeName)
+	}
+	if _, ok := providerTypes[typeName]; ok {
+		panic("dnscli: RegisterProvider called twice for " + typeName)
+	}
+	required := make([]string, len(requiredKeys))
+	copy(required, requiredKeys)
+	providerTypes[typeName] = providerType{typeName, required, factory}
+}
+
+func registeredProviders() []providerType {
+	providerTypesLock.RLock()
+	defer providerTypesLock.RUnlock()
+	result := make([]providerType, 0, len(providerTypes))
+	for _, v := range providerTypes {
+		result = append(result, v)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// newProvider builds the provider configured as name in Config.Providers.
+// Errors name the entry so a broken config.json is easy to fix.
+func newProvider(name string, info map[string]string) (DNSProvider, error) {
+	typeName, ok := info["Type"]
+	if !ok || typeName == "" {
+		return nil, fmt.Errorf("provider %q: Type not set", name)
+	}
+	providerTypesLock.RLock()
+	t, ok := providerTypes[typeName]
+	providerTypesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("provider %q: unknown Type %q", name, typeName)
+	}
+	for _, k := range t.Required {
+		if v, ok := info[k]; !ok || v == "" {
+			return nil, fmt.Errorf("provider %q (Type %s): missing %s", name, typeName, k)
+		}
+	}
+	p, err := t.factory(info)
+	if err != nil {
+		return nil, fmt.Errorf("provider %q (Type %s): %s", name, typeName, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,232 @@
+package dnscli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DomainConfig is the entry of a domain in Config.Domains, either the name
+// of its provider or an object also naming the Replicas which mirror every
+// change made to it.
+type DomainConfig struct {
+	Provider string
+	Replicas []string
+}
+
+func (s *DomainConfig) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Provider); err == nil {
+		return nil
+	}
+	type plain DomainConfig
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// replicatedProvider makes every change through the primary provider, then
+// mirrors it to the replicas. A replica failing does not undo the change, it
+// is returned as a *replicaError next to the changes of the primary and
+// `dns replicate-check` reports the drift. Lists read the primary only.
+type replicatedProvider struct {
+	DNSProvider
+	names    []string
+	replicas []DNSProvider
+	// metrics counts the replica failures when the daemon is instrumented.
+	metrics *metrics
+}
+
+// replicaError is returned when the primary made a change which some
+// replicas failed to mirror.
+type replicaError struct {
+	names []string
+	errs  []error
+}
+
+func (s *replicaError) Error() string {
+	result := make([]string, 0, len(s.names))
+	for i, v := range s.names {
+		result = append(result, fmt.Sprintf("replica %s: %s", v, s.errs[i]))
+	}
+	return strings.Join(result, "; ")
+}
+
+// replicaErrors returns the replica failures of err, and the error of the
+// primary, nil when only replicas failed.
+func replicaErrors(err error) ([]string, error) {
+	var r *replicaError
+	if !errors.As(err, &r) {
+		return nil, err
+	}
+	result := make([]string, 0, len(r.names))
+	for i, v := range r.names {
+		result = append(result, fmt.Sprintf("%s: %s", v, r.errs[i]))
+	}
+	return result, nil
+}
+
+// primaryError returns the error of the primary in err, nil when only
+// replicas failed: the change was made and is served, callers must not fail
+// or retry it.
+func primaryError(err error) error {
+	_, err = replicaErrors(err)
+	return err
+}
+
+func (s *replicatedProvider) Init() error {
+	if err := s.DNSProvider.Init(); err != nil {
+		return err
+	}
+	for i, v := range s.replicas {
+		if err := v.Init(); err != nil {
+			return fmt.Errorf("replica %s: %s", s.names[i], err)
+		}
+	}
+	return nil
+}
+
+func (s *replicatedProvider) mirror(Domain string, change func(DNSProvider) error) error {
+	failed := &replicaError{}
+	for i, v := range s.replicas {
+		if err := change(v); err != nil {
+			log.Printf("Replicate %s to %s error, %s", Domain, s.names[i], err)
+			failed.names = append(failed.names, s.names[i])
+			failed.errs = append(failed.errs, err)
+			if s.metrics != nil {
+				s.metrics.replicaError(s.names[i])
+			}
+		}
+	}
+	if len(failed.names) > 0 {
+		return failed
+	}
+	return nil
+}
+
+func (s *replicatedProvider) Present(Domain, record, recordType, recordValue string, recordTTL int) (*RecordChanges, error) {
+	result, err := s.DNSProvider.Present(Domain, record, recordType, recordValue, recordTTL)
+	if err == nil {
+		err = s.mirror(Domain, func(p DNSProvider) error {
+			_, err := p.Present(Domain, record, recordType, recordValue, recordTTL)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *replicatedProvider) Absent(Domain, record, recordType string) (*RecordChanges, error) {
+	result, err := s.DNSProvider.Absent(Domain, record, recordType)
+	if err == nil {
+		err = s.mirror(Domain, func(p DNSProvider) error {
+			_, err := p.Absent(Domain, record, recordType)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *replicatedProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	result, err := presentRRset(s.DNSProvider, Domain, record)
+	if err == nil {
+		err = s.mirror(Domain, func(p DNSProvider) error {
+			_, err := presentRRset(p, Domain, record)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *replicatedProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	result, err := applyChanges(s.DNSProvider, Domain, changes)
+	if err == nil {
+		err = s.mirror(Domain, func(p DNSProvider) error {
+			_, err := applyChanges(p, Domain, changes)
+			return err
+		})
+	}
+	return result, err
+}
+
+// comparableRRsets returns the RRsets of records with normalized values,
+// without the SOA and apex NS each provider sets for itself.
+func comparableRRsets(Domain string, records []DNSRecord) []DNSRecord {
+	result := make([]DNSRecord, 0, len(records))
+	for _, v := range groupRRsets(records) {
+		v.Type = strings.ToUpper(v.Type)
+		if v.Type == "SOA" || v.Type == "NS" && sameName(v.Name, Domain) {
+			continue
+		}
+		v.Name = strings.ToLower(fqdn(v.Name))
+		v.Datas = normalizeDatas(v.Name, v.Type, v.Datas)
+		result = append(result, v)
+	}
+	return result
+}
+
+// ReplicateCheck runs `dns replicate-check [domain...]`, comparing every
+// replica of the domains, or of all replicated domains, with the primary.
+func (s *Cli) ReplicateCheck(args []string) {
+	domains := make([]string, 0)
+	for _, v := range args {
+		domain := dns.Fqdn(v)
+		if _, ok := s.dnsProviders[domain]; !ok {
+			fmt.Printf("Unknown domain %s.\n", v)
+			os.Exit(1)
+		}
+		domains = append(domains, domain)
+	}
+	if len(args) == 0 {
+		for k, v := range s.dnsProviders {
+			if _, ok := v.(*replicatedProvider); ok {
+				domains = append(domains, k)
+			}
+		}
+		sort.Strings(domains)
+	}
+	drift := false
+	for _, domain := range domains {
+		p, ok := s.dnsProviders[domain].(*replicatedProvider)
+		if !ok {
+			fmt.Printf("%s has no replica.\n", domain)
+			continue
+		}
+		if err := p.DNSProvider.Init(); err != nil {
+			fmt.Printf("Init provider error, %s.\n", err.Error())
+			os.Exit(1)
+		}
+		primary, err := p.DNSProvider.List(domain)
+		if err != nil {
+			fmt.Printf("List domain err, %s.\n", err.Error())
+			os.Exit(1)
+		}
+		primary = comparableRRsets(domain, primary)
+		for i, v := range p.replicas {
+			if err := v.Init(); err != nil {
+				fmt.Printf("Init %s error, %s.\n", p.names[i], err.Error())
+				drift = true
+				continue
+			}
+			records, err := v.List(domain)
+			if err != nil {
+				fmt.Printf("List %s on %s err, %s.\n", domain, p.names[i], err.Error())
+				drift = true
+				continue
+			}
+			changes := diffRRsets(comparableRRsets(domain, records), primary)
+			if len(changes.Add)+len(changes.Delete) == 0 {
+				fmt.Printf("%s on %s in sync.\n", domain, p.names[i])
+				continue
+			}
+			drift = true
+			fmt.Printf("%s on %s drifted, changes to match %s:\n", domain, p.names[i], s.providerName(domain))
+			printChanges(changes)
+		}
+	}
+	if drift {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,49 @@
+package dnscli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestReplicaFailureUpdate(t *testing.T) {
+	primary := &MemoryProvider{zones: make(map[string][]DNSRecord)}
+	replica := &failingProvider{MemoryProvider: &MemoryProvider{zones: make(map[string][]DNSRecord)}, failAt: 1}
+	m := newMetrics()
+	p := &instrumentedProvider{
+		DNSProvider:  &replicatedProvider{DNSProvider: primary, names: []string{"Backup"}, replicas: []DNSProvider{replica}, metrics: m},
+		providerType: "InMemory",
+		metrics:      m,
+	}
+	s := &Cli{dnsProviders: map[string]DNSProvider{"example.com.": p}, cache: newZoneCache(0), metrics: m}
+	r := new(dns.Msg)
+	r.SetUpdate("example.com.")
+	r.Insert([]dns.RR{mustRR(t, "www.example.com. 300 IN A 192.0.2.1")})
+	reply := new(dns.Msg)
+	reply.SetReply(r)
+	changes, err := s.handleUpdate(r, reply, &TsigKey{Update: true})
+	if reply.Rcode != dns.RcodeSuccess {
+		t.Errorf("rcode %s, want NOERROR", dns.RcodeToString[reply.Rcode])
+	}
+	replicas, err := replicaErrors(err)
+	if err != nil || len(replicas) != 1 || !strings.HasPrefix(replicas[0], "Backup: ") {
+		t.Errorf("replica errors %v, error %v", replicas, err)
+	}
+	want := []DNSRecord{{"www.example.com.", "A", 300, []string{"192.0.2.1"}}}
+	if changes == nil {
+		t.Fatal("no changes returned")
+	}
+	checkRRsets(t, "added", changes.Add, want)
+	records, _ := primary.List("example.com.")
+	checkRRsets(t, "primary", records, want)
+
+	report := new(strings.Builder)
+	m.write(report, s.cache)
+	if !strings.Contains(report.String(), `dnscli_replica_errors_total{replica="Backup"} 1`) {
+		t.Errorf("replica error not counted:\n%s", report)
+	}
+	if strings.Contains(report.String(), "dnscli_provider_errors_total{") {
+		t.Errorf("replica error counted as a provider error:\n%s", report)
+	}
+}
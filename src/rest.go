@@ -0,0 +1,153 @@
+package dnscli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// restError is returned by restClient when the API answers with a non 2xx
+// status code.
+type restError struct {
+	Status int
+	Body   string
+}
+
+func (s *restError) Error() string {
+	return fmt.Sprintf("api error, code: %d, %s", s.Status, strings.TrimSpace(s.Body))
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*restError)
+	return ok && e.Status == http.StatusNotFound
+}
+
+// restClient is the small JSON over HTTP client shared by providers talking
+// to plain REST APIs.
+type restClient struct {
+	endpoint string
+	header   http.Header
+	client   *http.Client
+}
+
+func newRestClient(endpoint string, header http.Header) *restClient {
+	return &restClient{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		header:   header,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends body as JSON and decodes the response into result when both are
+// not nil. path may be absolute, as returned in pagination links.
+func (s *restClient) do(method, path string, body, result interface{}) (http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	url := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = s.endpoint + path
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	data, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return rsp.Header, &restError{rsp.StatusCode, string(data)}
+	}
+	if result != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, result); err != nil {
+			return rsp.Header, err
+		}
+	}
+	return rsp.Header, nil
+}
+
+var linkNextRegexp = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?next"?`)
+
+// nextLink returns the rel="next" target of a RFC 8288 Link header.
+func nextLink(header http.Header) string {
+	for _, v := range header["Link"] {
+		if m := linkNextRegexp.FindStringSubmatch(v); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// subName returns record relative to Domain, with apex for the zone itself.
+func subName(Domain, record, apex string) string {
+	Domain = strings.ToLower(fqdn(Domain))
+	record = strings.ToLower(fqdn(record))
+	if record == Domain {
+		return apex
+	}
+	return strings.TrimSuffix(record, "."+Domain)
+}
+
+// absName is the inverse of subName.
+func absName(Domain, sub, apex string) string {
+	if sub == apex || sub == "" || sub == "@" {
+		return fqdn(Domain)
+	}
+	return fqdn(sub + "." + defqdn(Domain))
+}
+
+// zoneDatas returns the values of record as zone file data, with TXT text
+// quoted, which APIs taking the presentation format expect.
+func zoneDatas(record DNSRecord) []string {
+	if !strings.EqualFold(record.Type, "TXT") {
+		return record.Datas
+	}
+	rrs, err := DNSRecord2RR(record)
+	if err != nil {
+		return record.Datas
+	}
+	result := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		result = append(result, strings.TrimPrefix(rr.String(), rr.Header().String()))
+	}
+	return result
+}
+
+// textDatas is the inverse of zoneDatas, TXT values are returned as text.
+func textDatas(Type string, datas []string) []string {
+	if !strings.EqualFold(Type, "TXT") {
+		return datas
+	}
+	result := make([]string, 0, len(datas))
+	for _, v := range datas {
+		if rrs, err := DNSRecord2RR(DNSRecord{"txt.", "TXT", 0, []string{v}}); err == nil && len(rrs) == 1 {
+			v = rr2Record(rrs[0]).Datas[0]
+		}
+		result = append(result, v)
+	}
+	return result
+}
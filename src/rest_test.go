@@ -0,0 +1,111 @@
+package dnscli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fixture is a recorded API exchange. Body, and Header values, may hold
+// {{server}} for the URL of the test server. Request, when set, is the JSON
+// body the provider must send.
+type fixture struct {
+	Method  string
+	URI     string
+	Request string
+	Status  int
+	Header  map[string]string
+	Body    string
+}
+
+// fixtureServer answers the fixtures in order and fails the test on any
+// other request.
+func fixtureServer(t *testing.T, fixtures []fixture) *httptest.Server {
+	var lock sync.Mutex
+	next := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if next >= len(fixtures) {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.RequestURI())
+			http.Error(w, "unexpected request", http.StatusInternalServerError)
+			return
+		}
+		f := fixtures[next]
+		next++
+		if r.Method != f.Method || r.URL.RequestURI() != f.URI {
+			t.Errorf("request %d is %s %s, want %s %s", next, r.Method, r.URL.RequestURI(), f.Method, f.URI)
+		}
+		if f.Request != "" {
+			body, _ := ioutil.ReadAll(r.Body)
+			var got, want interface{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Errorf("request %d body %q, %s", next, body, err)
+			}
+			if err := json.Unmarshal([]byte(f.Request), &want); err != nil {
+				// t.Fatalf must not be called outside the test goroutine.
+				t.Errorf("fixture %d request, %s", next, err)
+				http.Error(w, "bad fixture", http.StatusInternalServerError)
+				return
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("request %d body %s, want %s", next, body, f.Request)
+			}
+		}
+		for k, v := range f.Header {
+			w.Header().Set(k, strings.Replace(v, "{{server}}", server.URL, -1))
+		}
+		if f.Body != "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		status := f.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(strings.Replace(f.Body, "{{server}}", server.URL, -1)))
+	}))
+	t.Cleanup(func() {
+		server.Close()
+		if next != len(fixtures) {
+			t.Errorf("%d of %d fixtures used", next, len(fixtures))
+		}
+	})
+	return server
+}
+
+// fixtureProvider builds a provider of typeName talking to the fixtures.
+func fixtureProvider(t *testing.T, typeName string, fixtures []fixture) DNSProvider {
+	return fixtureProviderInfo(t, map[string]string{"Type": typeName, "Token": "TOKEN"}, fixtures)
+}
+
+// fixtureProviderInfo builds a provider from info talking to the fixtures.
+// Info values may hold {{server}}, Endpoint defaults to the test server.
+func fixtureProviderInfo(t *testing.T, info map[string]string, fixtures []fixture) DNSProvider {
+	server := fixtureServer(t, fixtures)
+	conf := map[string]string{"Endpoint": server.URL}
+	for k, v := range info {
+		conf[k] = strings.Replace(v, "{{server}}", server.URL, -1)
+	}
+	p, err := newProvider("test", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func checkRRsets(t *testing.T, what string, got, want []DNSRecord) {
+	t.Helper()
+	if !sameRRsets(got, want) {
+		t.Errorf("%s %v, want %v", what, sortedRRsets(got), sortedRRsets(want))
+	}
+}
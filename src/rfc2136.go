@@ -3,7 +3,7 @@ package dnscli
 import (
 	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
@@ -33,13 +33,23 @@ func (s *Rfc2136Provier) List(Domain string) ([]DNSRecord, error) {
 	result := make([]DNSRecord, 0)
 	for v := range channel {
 		if v.Error != nil {
-			return nil, err
+			return nil, v.Error
 		}
-		result = append(result, RR2DNSRecord(v.RR)...)
+		result = append(result, rrs2Records(v.RR)...)
 	}
 	return result, nil
 }
 
+// rrs2Records converts rrs with rr2Record, RR2DNSRecord formats values for
+// display only and DNSRecord2RR can not parse them back.
+func rrs2Records(rrs []dns.RR) []DNSRecord {
+	result := make([]DNSRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		result = append(result, rr2Record(rr))
+	}
+	return result
+}
+
 func (s *Rfc2136Provier) query(Domain, record, recordType string) ([]dns.RR, error) {
 	m := &dns.Msg{}
 	if _, ok := dns.StringToType[recordType]; !ok {
@@ -59,11 +69,7 @@ func (s *Rfc2136Provier) query(Domain, record, recordType string) ([]dns.RR, err
 	return result, nil
 }
 
-func (s *Rfc2136Provier) Present(Domain, record, recordType, recordValue string, recordTTL int) (*RecordChanges, error) {
-	r, err := s.query(Domain, record, recordType)
-	if err != nil {
-		return nil, err
-	}
+func (s *Rfc2136Provier) exchange(m *dns.Msg) error {
 	tsigSecret := map[string]string{
 		s.TsigName: s.Tsig,
 	}
@@ -71,30 +77,78 @@ func (s *Rfc2136Provier) Present(Domain, record, recordType, recordValue string,
 		Net:        "tcp",
 		TsigSecret: tsigSecret,
 	}
-	m := &dns.Msg{}
-	m.Id = dns.Id()
-	m = m.SetUpdate(dns.Fqdn(Domain))
-	m.RemoveRRset(r)
-	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(record), recordTTL, recordType, recordValue))
+	m = m.SetTsig(s.TsigName, s.TsigAlg, 300, time.Now().Unix())
+	in, _, err := c.Exchange(m, s.Host)
+	if err != nil {
+		return err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136 error, code: %d", in.Rcode)
+	}
+	return nil
+}
+
+func (s *Rfc2136Provier) Present(Domain, record, recordType, recordValue string, recordTTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{record, recordType, recordTTL, []string{recordValue}})
+}
+
+func (s *Rfc2136Provier) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
 	if err != nil {
 		return nil, err
 	}
-	m.Insert([]dns.RR{rr})
-	m = m.SetTsig(s.TsigName, s.TsigAlg, 300, time.Now().Unix())
-	in, _, err := c.Exchange(m, s.Host)
+	r, err := s.query(Domain, record.Name, record.Type)
 	if err != nil {
 		return nil, err
 	}
-	if in.Rcode != dns.RcodeSuccess {
-		return nil, fmt.Errorf("rfc2136 error, code: %d", in.Rcode)
+	rrs, err := DNSRecord2RR(record)
+	if err != nil {
+		return nil, err
+	}
+	m := &dns.Msg{}
+	m.Id = dns.Id()
+	m = m.SetUpdate(dns.Fqdn(Domain))
+	m.RemoveRRset(r)
+	m.Insert(rrs)
+	if err := s.exchange(m); err != nil {
+		return nil, err
 	}
 	RecordChanges := &RecordChanges{
-		Delete: RR2DNSRecord(r),
-		Add:    RR2DNSRecord([]dns.RR{rr}),
+		Delete: rrs2Records(r),
+		Add:    rrs2Records(rrs),
 	}
 	return RecordChanges, nil
 }
 
+// ApplyChanges sends every RRset in one UPDATE message, which the server
+// applies atomically.
+func (s *Rfc2136Provier) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	m := &dns.Msg{}
+	m.Id = dns.Id()
+	m = m.SetUpdate(dns.Fqdn(Domain))
+	for _, v := range append(append([]DNSRecord{}, changes.Delete...), changes.Add...) {
+		m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{
+			Name:   fqdn(v.Name),
+			Rrtype: dns.StringToType[strings.ToUpper(v.Type)],
+		}}})
+	}
+	for _, v := range changes.Add {
+		record, err := checkRecord(Domain, v)
+		if err != nil {
+			return nil, err
+		}
+		rrs, err := DNSRecord2RR(record)
+		if err != nil {
+			return nil, err
+		}
+		m.Insert(rrs)
+	}
+	if err := s.exchange(m); err != nil {
+		return nil, err
+	}
+	return &changes, nil
+}
+
 func (s *Rfc2136Provier) Absent(Domain, record, recordType string) (*RecordChanges, error) {
 	r, err := s.query(Domain, record, recordType)
 	if err != nil {
@@ -103,28 +157,15 @@ func (s *Rfc2136Provier) Absent(Domain, record, recordType string) (*RecordChang
 	if len(r) <= 0 {
 		return nil, errors.New("record not found")
 	}
-	tsigSecret := map[string]string{
-		s.TsigName: s.Tsig,
-	}
-	c := dns.Client{
-		Net:        "tcp",
-		TsigSecret: tsigSecret,
-	}
 	m := &dns.Msg{}
 	m.Id = dns.Id()
 	m = m.SetUpdate(dns.Fqdn(Domain))
 	m.RemoveRRset(r)
-	m = m.SetTsig(s.TsigName, s.TsigAlg, 300, time.Now().Unix())
-	in, _, err := c.Exchange(m, s.Host)
-	if err != nil {
-		log.Printf("%#v", in)
+	if err := s.exchange(m); err != nil {
 		return nil, err
 	}
-	if in.Rcode != dns.RcodeSuccess {
-		return nil, fmt.Errorf("rfc2136 error, code: %d", in.Rcode)
-	}
 	RecordChanges := &RecordChanges{
-		Delete: RR2DNSRecord(r),
+		Delete: rrs2Records(r),
 	}
 	return RecordChanges, nil
 }
@@ -133,27 +174,31 @@ func (s *Rfc2136Provier) Init() error {
 	return nil
 }
 
-func NewRfc2135Provier(info map[string]string) DNSProvider {
+func init() {
+	RegisterProvider("Rfc2136", NewRfc2135Provier, "Host", "TsigName", "Tsig")
+}
+
+func NewRfc2135Provier(info map[string]string) (DNSProvider, error) {
 	p := &Rfc2136Provier{}
 	if v, ok := info["Tsig"]; ok {
 		p.Tsig = v
 	} else {
-		log.Fatal("RFC2136: Tsig not found.")
+		return nil, errors.New("rfc2136: Tsig not found")
 	}
 	if v, ok := info["Host"]; ok {
 		p.Host = v
 	} else {
-		log.Fatal("RFC2136: Host not found.")
+		return nil, errors.New("rfc2136: Host not found")
 	}
 	if v, ok := info["TsigName"]; ok {
 		p.TsigName = v
 	} else {
-		log.Fatal("RFC2136: Tsig Name not found.")
+		return nil, errors.New("rfc2136: Tsig Name not found")
 	}
 	if v, ok := info["TsigAlg"]; ok {
 		p.TsigAlg = v
 	} else {
 		p.TsigAlg = "hmac-sha1."
 	}
-	return p
+	return p, nil
 }
@@ -0,0 +1,34 @@
+package dnscli
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestRrs2RecordsRoundTrip(t *testing.T) {
+	for _, v := range []string{
+		"www.example.com. 300 IN A 192.0.2.1",
+		"_sip._tcp.example.com. 300 IN SRV 10 20 5060 sip.example.com.",
+		`www.example.com. 300 IN TXT "hello world"`,
+		`example.com. 300 IN CAA 0 issue "ca.example.net; account=1"`,
+		"example.com. 300 IN MX 10 mx.example.com.",
+	} {
+		rr, err := dns.NewRR(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records := rrs2Records([]dns.RR{rr})
+		if len(records) != 1 {
+			t.Fatalf("%s gives %d records", v, len(records))
+		}
+		back, err := DNSRecord2RR(records[0])
+		if err != nil {
+			t.Errorf("%s, %s", v, err)
+			continue
+		}
+		if len(back) != 1 || !dns.IsDuplicate(back[0], rr) {
+			t.Errorf("%s parsed back as %v", v, back)
+		}
+	}
+}
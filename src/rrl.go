@@ -0,0 +1,103 @@
+package dnscli
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxRateBuckets bounds the client networks tracked, the least recently seen
+// ones are forgotten first.
+const maxRateBuckets = 100000
+
+type rateBucket struct {
+	key     string
+	tokens  float64
+	last    time.Time
+	dropped int
+}
+
+// rateLimiter limits the responses sent to every client network to rate per
+// second, with bursts of one second of responses. Every slip-th dropped
+// response is sent truncated instead, so real clients behind a spoofed
+// network can retry over TCP.
+type rateLimiter struct {
+	rate    float64
+	slip    int
+	lock    sync.Mutex
+	buckets map[string]*list.Element
+	// order holds the buckets from the least to the most recently seen.
+	order *list.List
+}
+
+func newRateLimiter(rate, slip int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(rate),
+		slip:    slip,
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// clientNet returns the network addr is limited with, a /24 for IPv4 and a
+// /56 for IPv6.
+func clientNet(addr net.Addr) string {
+	var ip net.IP
+	switch v := addr.(type) {
+	case *net.UDPAddr:
+		ip = v.IP
+	case *net.TCPAddr:
+		ip = v.IP
+	default:
+		return addr.String()
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(56, 128)).String()
+}
+
+// check tells whether a response to addr may be sent, and otherwise whether
+// it should slip as a truncated one.
+func (s *rateLimiter) check(addr net.Addr) (allow, slip bool) {
+	now := time.Now()
+	key := clientNet(addr)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var b *rateBucket
+	if e, ok := s.buckets[key]; ok {
+		b = e.Value.(*rateBucket)
+		s.order.MoveToBack(e)
+	} else {
+		if len(s.buckets) >= maxRateBuckets {
+			s.forget(now)
+		}
+		b = &rateBucket{key: key, tokens: s.rate, last: now}
+		s.buckets[key] = s.order.PushBack(b)
+	}
+	b.tokens += now.Sub(b.last).Seconds() * s.rate
+	if b.tokens > s.rate {
+		b.tokens = s.rate
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, false
+	}
+	b.dropped++
+	return false, s.slip > 0 && b.dropped%s.slip == 0
+}
+
+// forget drops the buckets which refilled completely, and the least recently
+// seen ones while there are still too many.
+func (s *rateLimiter) forget(now time.Time) {
+	for e := s.order.Front(); e != nil; e = s.order.Front() {
+		b := e.Value.(*rateBucket)
+		if now.Sub(b.last) <= time.Second && len(s.buckets) < maxRateBuckets {
+			break
+		}
+		delete(s.buckets, b.key)
+		s.order.Remove(e)
+	}
+}
@@ -0,0 +1,211 @@
+package dnscli
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS records (
+	zone TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	ttl  INTEGER NOT NULL,
+	data TEXT NOT NULL,
+	PRIMARY KEY (zone, name, type, data)
+)`
+
+type SQLiteProvider struct {
+	Path   string
+	inited bool
+	db     *sql.DB
+}
+
+func (s *SQLiteProvider) zoneKey(Domain string) string {
+	return strings.ToLower(fqdn(Domain))
+}
+
+func (s *SQLiteProvider) selectRRsets(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}, query string, args ...interface{}) ([]DNSRecord, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make([]DNSRecord, 0)
+	for rows.Next() {
+		record := DNSRecord{}
+		data := ""
+		if err := rows.Scan(&record.Name, &record.Type, &record.TTL, &data); err != nil {
+			return nil, err
+		}
+		if n := len(result); n > 0 && sameRRset(result[n-1], record) {
+			result[n-1].Datas = append(result[n-1].Datas, data)
+			continue
+		}
+		record.Datas = []string{data}
+		result = append(result, record)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLiteProvider) List(Domain string) ([]DNSRecord, error) {
+	return s.selectRRsets(s.db,
+		"SELECT name, type, ttl, data FROM records WHERE zone = ? ORDER BY name, type, rowid",
+		s.zoneKey(Domain))
+}
+
+func (s *SQLiteProvider) Present(Domain, Record, Type, Value string, TTL int) (*RecordChanges, error) {
+	return s.PresentRRset(Domain, DNSRecord{Record, Type, TTL, []string{Value}})
+}
+
+func (s *SQLiteProvider) PresentRRset(Domain string, record DNSRecord) (*RecordChanges, error) {
+	record, err := checkRecord(Domain, record)
+	if err != nil {
+		return nil, err
+	}
+	record.Name = strings.ToLower(record.Name)
+	zone := s.zoneKey(Domain)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	deleted, err := s.selectRRsets(tx,
+		"SELECT name, type, ttl, data FROM records WHERE zone = ? AND name = ? AND type = ? ORDER BY rowid",
+		zone, record.Name, record.Type)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM records WHERE zone = ? AND name = ? AND type = ?",
+		zone, record.Name, record.Type); err != nil {
+		return nil, err
+	}
+	for _, v := range record.Datas {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO records (zone, name, type, ttl, data) VALUES (?, ?, ?, ?, ?)",
+			zone, record.Name, record.Type, record.TTL, v); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &RecordChanges{
+		Add:    []DNSRecord{record},
+		Delete: deleted,
+	}, nil
+}
+
+// ApplyChanges replaces every RRset of changes in one transaction.
+func (s *SQLiteProvider) ApplyChanges(Domain string, changes RecordChanges) (*RecordChanges, error) {
+	zone := s.zoneKey(Domain)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	recordChanges := &RecordChanges{}
+	touched := make(map[string]bool)
+	for _, v := range append(append([]DNSRecord{}, changes.Delete...), changes.Add...) {
+		name, rrtype := strings.ToLower(fqdn(v.Name)), strings.ToUpper(v.Type)
+		if touched[name+" "+rrtype] {
+			continue
+		}
+		touched[name+" "+rrtype] = true
+		deleted, err := s.selectRRsets(tx,
+			"SELECT name, type, ttl, data FROM records WHERE zone = ? AND name = ? AND type = ? ORDER BY rowid",
+			zone, name, rrtype)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM records WHERE zone = ? AND name = ? AND type = ?",
+			zone, name, rrtype); err != nil {
+			return nil, err
+		}
+		recordChanges.Delete = append(recordChanges.Delete, deleted...)
+	}
+	for _, v := range changes.Add {
+		record, err := checkRecord(Domain, v)
+		if err != nil {
+			return nil, err
+		}
+		record.Name = strings.ToLower(record.Name)
+		for _, data := range record.Datas {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO records (zone, name, type, ttl, data) VALUES (?, ?, ?, ?, ?)",
+				zone, record.Name, record.Type, record.TTL, data); err != nil {
+				return nil, err
+			}
+		}
+		recordChanges.Add = append(recordChanges.Add, record)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return recordChanges, nil
+}
+
+func (s *SQLiteProvider) Absent(Domain, Record, Type string) (*RecordChanges, error) {
+	zone := s.zoneKey(Domain)
+	Record = strings.ToLower(fqdn(Record))
+	Type = strings.ToUpper(Type)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	deleted, err := s.selectRRsets(tx,
+		"SELECT name, type, ttl, data FROM records WHERE zone = ? AND name = ? AND type = ? ORDER BY rowid",
+		zone, Record, Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return nil, errors.New("records not found")
+	}
+	if _, err := tx.Exec("DELETE FROM records WHERE zone = ? AND name = ? AND type = ?",
+		zone, Record, Type); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &RecordChanges{
+		Delete: deleted,
+	}, nil
+}
+
+func (s *SQLiteProvider) Init() error {
+	if s.inited {
+		return nil
+	}
+	db, err := sql.Open("sqlite", s.Path)
+	if err != nil {
+		return err
+	}
+	// SQLite serialises writers anyway, a single connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return err
+	}
+	s.db = db
+	s.inited = true
+	return nil
+}
+
+func init() {
+	RegisterProvider("SQLite", NewSQLiteProvider, "Path")
+}
+
+func NewSQLiteProvider(info map[string]string) (DNSProvider, error) {
+	p := &SQLiteProvider{}
+	if v, ok := info["Path"]; ok && v != "" {
+		p.Path = v
+	} else {
+		return nil, errors.New("sqlite: Path not found")
+	}
+	return p, nil
+}
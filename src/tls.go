@@ -0,0 +1,87 @@
+package dnscli
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certCheckInterval is how often the certificate files are checked for
+// changes.
+const certCheckInterval = time.Minute
+
+// certLoader serves the certificate in certFile and keyFile, and loads them
+// again once they change, so renewed certificates are used without restart.
+type certLoader struct {
+	certFile string
+	keyFile  string
+	lock     sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func newCertLoader(certFile, keyFile string) (*certLoader, error) {
+	s := &certLoader{certFile: certFile, keyFile: keyFile}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// lastModified returns the latest modification time of the two files.
+func (s *certLoader) lastModified() (time.Time, error) {
+	var result time.Time
+	for _, v := range []string{s.certFile, s.keyFile} {
+		info, err := os.Stat(v)
+		if err != nil {
+			return result, err
+		}
+		if info.ModTime().After(result) {
+			result = info.ModTime()
+		}
+	}
+	return result, nil
+}
+
+func (s *certLoader) load() error {
+	modTime, err := s.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
+	if err != nil {
+		return err
+	}
+	s.cert, s.modTime, s.checked = &cert, modTime, time.Now()
+	return nil
+}
+
+// getCertificate is the tls.Config GetCertificate callback. A certificate
+// failing to load keeps the previous one in use.
+func (s *certLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if time.Since(s.checked) < certCheckInterval {
+		return s.cert, nil
+	}
+	s.checked = time.Now()
+	if modTime, err := s.lastModified(); err != nil || !modTime.After(s.modTime) {
+		return s.cert, nil
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Reload certificate %s failed, %s", s.certFile, err)
+	} else {
+		log.Printf("Certificate %s reloaded", s.certFile)
+	}
+	return s.cert, nil
+}
+
+func (s *certLoader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: s.getCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+}
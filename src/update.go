@@ -0,0 +1,364 @@
+package dnscli
+
+import (
+	"log"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// findZone returns the configured domain which is exactly name, unlike
+// findDomain it never matches a parent or a lookalike.
+func (s *Cli) findZone(name string) string {
+	for k := range s.dnsProviders {
+		if sameName(k, name) {
+			return k
+		}
+	}
+	return ""
+}
+
+// checkZone validates the zone section of an UPDATE, RFC 2136 §3.1.
+func (s *Cli) checkZone(r *dns.Msg) (string, int) {
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return "", dns.RcodeFormatError
+	}
+	if r.Question[0].Qclass != dns.ClassINET {
+		return "", dns.RcodeNotAuth
+	}
+	zone := s.findZone(r.Question[0].Name)
+	if zone == "" {
+		return "", dns.RcodeNotAuth
+	}
+	return zone, dns.RcodeSuccess
+}
+
+func nameInUse(rrs []dns.RR, name string) bool {
+	for _, v := range rrs {
+		if sameName(v.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func rrsetOf(rrs []dns.RR, name string, rrtype uint16) []dns.RR {
+	result := make([]dns.RR, 0)
+	for _, v := range rrs {
+		if v.Header().Rrtype == rrtype && sameName(v.Header().Name, name) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func containsRR(rrs []dns.RR, rr dns.RR) bool {
+	for _, v := range rrs {
+		if dns.IsDuplicate(v, rr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameRRs tells whether l and r hold the same RRs, ignoring TTL and order.
+func sameRRs(l, r []dns.RR) bool {
+	for _, v := range l {
+		if !containsRR(r, v) {
+			return false
+		}
+	}
+	for _, v := range r {
+		if !containsRR(l, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPreReq evaluates the prerequisite section against the RRs of zone,
+// RFC 2136 §3.2.
+func checkPreReq(zone string, prereqs []dns.RR, rrs []dns.RR) int {
+	// Value dependent prerequisites are compared as whole RRsets once they
+	// are all collected, RFC 2136 §3.2.3.
+	temp := make([]dns.RR, 0)
+	for _, rr := range prereqs {
+		h := rr.Header()
+		if h.Ttl != 0 {
+			return dns.RcodeFormatError
+		}
+		if !dns.IsSubDomain(zone, h.Name) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassANY:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if !nameInUse(rrs, h.Name) {
+					return dns.RcodeNameError
+				}
+			} else if len(rrsetOf(rrs, h.Name, h.Rrtype)) == 0 {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if h.Rdlength != 0 {
+				return dns.RcodeFormatError
+			}
+			if h.Rrtype == dns.TypeANY {
+				if nameInUse(rrs, h.Name) {
+					return dns.RcodeYXDomain
+				}
+			} else if len(rrsetOf(rrs, h.Name, h.Rrtype)) > 0 {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			if h.Rrtype == dns.TypeANY {
+				return dns.RcodeFormatError
+			}
+			temp = append(temp, rr)
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	for _, rr := range temp {
+		h := rr.Header()
+		if !sameRRs(rrsetOf(temp, h.Name, h.Rrtype), rrsetOf(rrs, h.Name, h.Rrtype)) {
+			return dns.RcodeNXRrset
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+func isMetaType(rrtype uint16) bool {
+	switch rrtype {
+	case dns.TypeANY, dns.TypeAXFR, dns.TypeIXFR, dns.TypeMAILA, dns.TypeMAILB,
+		dns.TypeOPT, dns.TypeTSIG, dns.TypeTKEY:
+		return true
+	}
+	return false
+}
+
+// prescanUpdate checks the update section before anything is changed,
+// RFC 2136 §3.4.1.
+func prescanUpdate(zone string, updates []dns.RR) int {
+	for _, rr := range updates {
+		h := rr.Header()
+		if !dns.IsSubDomain(zone, h.Name) {
+			return dns.RcodeNotZone
+		}
+		switch h.Class {
+		case dns.ClassINET:
+			if isMetaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassANY:
+			if h.Ttl != 0 || h.Rdlength != 0 || (h.Rrtype != dns.TypeANY && isMetaType(h.Rrtype)) {
+				return dns.RcodeFormatError
+			}
+		case dns.ClassNONE:
+			if h.Ttl != 0 || isMetaType(h.Rrtype) {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// isApexProtected tells whether a delete of rrtype at name must be ignored,
+// the SOA and NS RRsets of the zone apex can not be removed.
+func isApexProtected(zone, name string, rrtype uint16) bool {
+	return sameName(zone, name) && (rrtype == dns.TypeSOA || rrtype == dns.TypeNS)
+}
+
+func findRRset(records []DNSRecord, name string, rrtype uint16) int {
+	target := DNSRecord{Name: name, Type: dns.TypeToString[rrtype]}
+	for i, v := range records {
+		if sameRRset(v, target) {
+			return i
+		}
+	}
+	return -1
+}
+
+// dataMatches tells whether data, a value of record in the provider format,
+// holds the same rdata as rr.
+func dataMatches(record DNSRecord, data string, rr dns.RR) bool {
+	rrs, err := DNSRecord2RR(DNSRecord{record.Name, record.Type, record.TTL, []string{data}})
+	if err != nil || len(rrs) != 1 {
+		return false
+	}
+	target := dns.Copy(rr)
+	target.Header().Class = dns.ClassINET
+	// TXT values are text, however it is cut into character strings.
+	if v, ok := target.(*dns.TXT); ok {
+		v.Txt = splitTXT(strings.Join(v.Txt, ""))
+		if old, ok := rrs[0].(*dns.TXT); ok {
+			old.Txt = splitTXT(strings.Join(old.Txt, ""))
+		}
+	}
+	return dns.IsDuplicate(rrs[0], target)
+}
+
+// addRR adds rr to its RRset, RFC 2136 §3.4.2.2.
+func addRR(zone string, records []DNSRecord, rr dns.RR) []DNSRecord {
+	h := rr.Header()
+	value := rr2Record(rr)
+	for _, v := range records {
+		if !sameName(v.Name, h.Name) {
+			continue
+		}
+		// CNAME can not live with other data at the same name.
+		if (h.Rrtype == dns.TypeCNAME) != strings.EqualFold(v.Type, "CNAME") {
+			return records
+		}
+	}
+	i := findRRset(records, h.Name, h.Rrtype)
+	if i < 0 {
+		return append(records, value)
+	}
+	switch h.Rrtype {
+	case dns.TypeSOA:
+		if old, err := DNSRecord2RR(records[i]); err == nil && len(old) == 1 {
+			if serial := rr.(*dns.SOA).Serial; int32(serial-old[0].(*dns.SOA).Serial) <= 0 {
+				return records
+			}
+		}
+		records[i] = value
+	case dns.TypeCNAME:
+		records[i] = value
+	default:
+		records[i].TTL = value.TTL
+		for _, data := range records[i].Datas {
+			if dataMatches(records[i], data, rr) {
+				return records
+			}
+		}
+		records[i].Datas = append(records[i].Datas, value.Datas...)
+	}
+	return records
+}
+
+// deleteRRset removes one RRset, RFC 2136 §2.5.2.
+func deleteRRset(zone string, records []DNSRecord, name string, rrtype uint16) []DNSRecord {
+	if isApexProtected(zone, name, rrtype) {
+		return records
+	}
+	if i := findRRset(records, name, rrtype); i >= 0 {
+		return append(records[:i], records[i+1:]...)
+	}
+	return records
+}
+
+// deleteName removes every RRset at name, RFC 2136 §2.5.3.
+func deleteName(zone string, records []DNSRecord, name string) []DNSRecord {
+	result := records[:0]
+	for _, v := range records {
+		if sameName(v.Name, name) && !isApexProtected(zone, name, dns.StringToType[strings.ToUpper(v.Type)]) {
+			continue
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// deleteRR removes the RR matching rr from its RRset, RFC 2136 §2.5.4. The
+// other values are kept in the format the provider returned them.
+func deleteRR(zone string, records []DNSRecord, rr dns.RR) []DNSRecord {
+	h := rr.Header()
+	if sameName(zone, h.Name) && h.Rrtype == dns.TypeSOA {
+		return records
+	}
+	i := findRRset(records, h.Name, h.Rrtype)
+	if i < 0 {
+		return records
+	}
+	datas := make([]string, 0, len(records[i].Datas))
+	for _, data := range records[i].Datas {
+		if !dataMatches(records[i], data, rr) {
+			datas = append(datas, data)
+		}
+	}
+	if len(datas) == 0 {
+		if h.Rrtype == dns.TypeNS && sameName(zone, h.Name) {
+			return records
+		}
+		return append(records[:i], records[i+1:]...)
+	}
+	records[i].Datas = datas
+	return records
+}
+
+// applyUpdate returns the RRsets of the zone once every RR of the update
+// section is applied, in order, to records.
+func applyUpdate(zone string, records []DNSRecord, updates []dns.RR) []DNSRecord {
+	result := make([]DNSRecord, 0, len(records))
+	for _, v := range records {
+		result = append(result, copyRecord(v))
+	}
+	for _, rr := range updates {
+		h := rr.Header()
+		switch {
+		case h.Class == dns.ClassINET:
+			result = addRR(zone, result, rr)
+		case h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+			result = deleteName(zone, result, h.Name)
+		case h.Class == dns.ClassANY:
+			result = deleteRRset(zone, result, h.Name, h.Rrtype)
+		default:
+			result = deleteRR(zone, result, rr)
+		}
+	}
+	return result
+}
+
+// handleUpdate evaluates the whole UPDATE against one listing of the zone and
+// applies the resulting RRsets as a single change. It returns the changes the
+// provider made and its error, if any. A replica failing is returned for the
+// audit log but the UPDATE succeeds, the primary made the change.
+func (s *Cli) handleUpdate(r *dns.Msg, m *dns.Msg, key *TsigKey) (*RecordChanges, error) {
+	domain, rcode := s.checkZone(r)
+	if rcode != dns.RcodeSuccess {
+		m.SetRcode(r, rcode)
+		return nil, nil
+	}
+	if !key.Update || !key.allowZone(domain) || !key.allowRRs(r.Answer) || !key.allowRRs(r.Ns) {
+		m.SetRcode(r, dns.RcodeRefused)
+		return nil, nil
+	}
+	if rcode := prescanUpdate(domain, r.Ns); rcode != dns.RcodeSuccess {
+		m.SetRcode(r, rcode)
+		return nil, nil
+	}
+	s.updateLock.Lock()
+	defer s.updateLock.Unlock()
+	p := s.dnsProviders[domain]
+	records, err := p.List(domain)
+	if err != nil {
+		log.Print(err)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return nil, err
+	}
+	if rcode := checkPreReq(domain, r.Answer, records2RR(records)); rcode != dns.RcodeSuccess {
+		m.SetRcode(r, rcode)
+		return nil, nil
+	}
+	before := groupRRsets(records)
+	changes := diffRRsets(before, applyUpdate(domain, before, r.Ns))
+	var result *RecordChanges
+	if len(changes.Add) > 0 || len(changes.Delete) > 0 {
+		result, err = applyChanges(p, domain, changes)
+		// A failed change may still be partly applied.
+		s.cache.invalidate(domain)
+		if primaryError(err) != nil {
+			log.Print(err)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			return result, err
+		}
+	}
+	m.SetRcode(r, dns.RcodeSuccess)
+	return result, err
+}
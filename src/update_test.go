@@ -0,0 +1,192 @@
+package dnscli
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// emptyRR builds an RR with no rdata, as sent by the prerequisite and delete
+// forms of RFC 2136.
+func emptyRR(name string, class, rrtype uint16) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrtype, Class: class}}
+}
+
+func TestCheckPreReq(t *testing.T) {
+	zone := []dns.RR{
+		mustRR(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600"),
+		mustRR(t, "example.com. 3600 IN NS ns1.example.com."),
+		mustRR(t, "www.example.com. 300 IN A 192.0.2.1"),
+		mustRR(t, "www.example.com. 300 IN A 192.0.2.2"),
+	}
+	ttl := mustRR(t, "www.example.com. 300 IN A 192.0.2.1")
+	chaos := emptyRR("www.example.com.", dns.ClassCHAOS, dns.TypeA)
+	rdlength := emptyRR("www.example.com.", dns.ClassANY, dns.TypeA)
+	rdlength.Header().Rdlength = 4
+	for _, c := range []struct {
+		Name    string
+		PreReqs []dns.RR
+		Rcode   int
+	}{
+		{"none", nil, dns.RcodeSuccess},
+		{"name in use", []dns.RR{emptyRR("WWW.example.com.", dns.ClassANY, dns.TypeANY)}, dns.RcodeSuccess},
+		{"name not in use", []dns.RR{emptyRR("ftp.example.com.", dns.ClassANY, dns.TypeANY)}, dns.RcodeNameError},
+		{"rrset exists", []dns.RR{emptyRR("www.example.com.", dns.ClassANY, dns.TypeA)}, dns.RcodeSuccess},
+		{"rrset missing", []dns.RR{emptyRR("www.example.com.", dns.ClassANY, dns.TypeAAAA)}, dns.RcodeNXRrset},
+		{"name absent", []dns.RR{emptyRR("ftp.example.com.", dns.ClassNONE, dns.TypeANY)}, dns.RcodeSuccess},
+		{"name present", []dns.RR{emptyRR("www.example.com.", dns.ClassNONE, dns.TypeANY)}, dns.RcodeYXDomain},
+		{"rrset absent", []dns.RR{emptyRR("www.example.com.", dns.ClassNONE, dns.TypeAAAA)}, dns.RcodeSuccess},
+		{"rrset present", []dns.RR{emptyRR("www.example.com.", dns.ClassNONE, dns.TypeA)}, dns.RcodeYXRrset},
+		{"rrset values", []dns.RR{
+			mustRR(t, "www.example.com. 0 IN A 192.0.2.2"),
+			mustRR(t, "www.example.com. 0 IN A 192.0.2.1"),
+		}, dns.RcodeSuccess},
+		{"rrset fewer values", []dns.RR{mustRR(t, "www.example.com. 0 IN A 192.0.2.1")}, dns.RcodeNXRrset},
+		{"rrset more values", []dns.RR{
+			mustRR(t, "www.example.com. 0 IN A 192.0.2.1"),
+			mustRR(t, "www.example.com. 0 IN A 192.0.2.2"),
+			mustRR(t, "www.example.com. 0 IN A 192.0.2.3"),
+		}, dns.RcodeNXRrset},
+		{"missing rrset values", []dns.RR{mustRR(t, "ftp.example.com. 0 IN A 192.0.2.1")}, dns.RcodeNXRrset},
+		{"outside the zone", []dns.RR{emptyRR("www.example.net.", dns.ClassANY, dns.TypeANY)}, dns.RcodeNotZone},
+		{"lookalike zone", []dns.RR{emptyRR("www.badexample.com.", dns.ClassANY, dns.TypeANY)}, dns.RcodeNotZone},
+		{"ttl", []dns.RR{ttl}, dns.RcodeFormatError},
+		{"rdata", []dns.RR{rdlength}, dns.RcodeFormatError},
+		{"values of any", []dns.RR{emptyRR("www.example.com.", dns.ClassINET, dns.TypeANY)}, dns.RcodeFormatError},
+		{"class", []dns.RR{chaos}, dns.RcodeFormatError},
+		{"first failure", []dns.RR{
+			emptyRR("www.example.com.", dns.ClassANY, dns.TypeA),
+			emptyRR("www.example.com.", dns.ClassNONE, dns.TypeA),
+			emptyRR("ftp.example.com.", dns.ClassANY, dns.TypeANY),
+		}, dns.RcodeYXRrset},
+	} {
+		if rcode := checkPreReq("example.com.", c.PreReqs, zone); rcode != c.Rcode {
+			t.Errorf("%s: rcode %s, want %s", c.Name, dns.RcodeToString[rcode], dns.RcodeToString[c.Rcode])
+		}
+	}
+}
+
+// updateZone returns the RRsets the update tests start from, in the format
+// providers list them.
+func updateZone() []DNSRecord {
+	return []DNSRecord{
+		{"example.com.", "SOA", 3600, []string{"ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600"}},
+		{"example.com.", "NS", 3600, []string{"ns1.example.com.", "ns2.example.com."}},
+		{"example.com.", "MX", 3600, []string{"10 mail.example.com."}},
+		{"www.example.com.", "A", 300, []string{"192.0.2.1", "192.0.2.2"}},
+		{"www.example.com.", "TXT", 300, []string{"hello world"}},
+	}
+}
+
+func TestApplyUpdateDelete(t *testing.T) {
+	zone := updateZone()
+	for _, c := range []struct {
+		Name    string
+		Updates []dns.RR
+		Want    []DNSRecord
+	}{
+		{"one value", []dns.RR{mustRR(t, "www.example.com. 0 NONE A 192.0.2.1")}, []DNSRecord{
+			zone[0], zone[1], zone[2],
+			{"www.example.com.", "A", 300, []string{"192.0.2.2"}},
+			zone[4],
+		}},
+		{"every value", []dns.RR{
+			mustRR(t, "www.example.com. 0 NONE A 192.0.2.1"),
+			mustRR(t, "www.example.com. 0 NONE A 192.0.2.2"),
+		}, []DNSRecord{zone[0], zone[1], zone[2], zone[4]}},
+		{"missing value", []dns.RR{mustRR(t, "www.example.com. 0 NONE A 192.0.2.9")}, zone},
+		{"text value", []dns.RR{mustRR(t, `www.example.com. 0 NONE TXT "hello " "world"`)}, zone[:4]},
+		{"rrset", []dns.RR{emptyRR("www.example.com.", dns.ClassANY, dns.TypeA)}, []DNSRecord{
+			zone[0], zone[1], zone[2], zone[4],
+		}},
+		{"missing rrset", []dns.RR{emptyRR("www.example.com.", dns.ClassANY, dns.TypeAAAA)}, zone},
+		{"name", []dns.RR{emptyRR("WWW.example.com.", dns.ClassANY, dns.TypeANY)}, zone[:3]},
+		{"missing name", []dns.RR{emptyRR("ftp.example.com.", dns.ClassANY, dns.TypeANY)}, zone},
+	} {
+		got := applyUpdate("example.com.", zone, c.Updates)
+		if !sameRRsets(got, c.Want) {
+			t.Errorf("%s: records %v, want %v", c.Name, sortedRRsets(got), sortedRRsets(c.Want))
+		}
+	}
+	if !sameRRsets(zone, updateZone()) {
+		t.Errorf("applyUpdate changed its input to %v", zone)
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	zone := updateZone()
+	soa := func(serial string) DNSRecord {
+		return DNSRecord{"example.com.", "SOA", 3600, []string{"ns1.example.com. hostmaster.example.com. " + serial + " 7200 3600 1209600 3600"}}
+	}
+	for _, c := range []struct {
+		Name    string
+		Updates []dns.RR
+		Want    []DNSRecord
+	}{
+		{"new rrset", []dns.RR{mustRR(t, "ftp.example.com. 60 IN AAAA 2001:db8::1")}, append(updateZone(),
+			DNSRecord{"ftp.example.com.", "AAAA", 60, []string{"2001:db8::1"}})},
+		{"new values", []dns.RR{
+			mustRR(t, "www.example.com. 60 IN A 192.0.2.3"),
+			mustRR(t, "www.example.com. 60 IN A 192.0.2.1"),
+			mustRR(t, "www.example.com. 60 IN A 192.0.2.4"),
+		}, []DNSRecord{
+			zone[0], zone[1], zone[2],
+			{"www.example.com.", "A", 60, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"}},
+			zone[4],
+		}},
+		{"duplicate text", []dns.RR{mustRR(t, `www.example.com. 300 IN TXT "hello " "world"`)}, zone},
+		{"cname over data", []dns.RR{mustRR(t, "www.example.com. 60 IN CNAME example.com.")}, zone},
+		{"data over cname", []dns.RR{
+			mustRR(t, "ftp.example.com. 60 IN CNAME example.com."),
+			mustRR(t, "ftp.example.com. 60 IN A 192.0.2.9"),
+		}, append(updateZone(), DNSRecord{"ftp.example.com.", "CNAME", 60, []string{"example.com."}})},
+		{"cname replaced", []dns.RR{
+			mustRR(t, "ftp.example.com. 60 IN CNAME example.com."),
+			mustRR(t, "ftp.example.com. 120 IN CNAME www.example.com."),
+		}, append(updateZone(), DNSRecord{"ftp.example.com.", "CNAME", 120, []string{"www.example.com."}})},
+		{"newer serial", []dns.RR{mustRR(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2 7200 3600 1209600 3600")},
+			[]DNSRecord{soa("2"), zone[1], zone[2], zone[3], zone[4]}},
+		{"same serial", []dns.RR{mustRR(t, "example.com. 3600 IN SOA ns2.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")}, zone},
+		{"older serial", []dns.RR{mustRR(t, "example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 0 7200 3600 1209600 3600")}, zone},
+		{"apex soa rrset", []dns.RR{emptyRR("example.com.", dns.ClassANY, dns.TypeSOA)}, zone},
+		{"apex ns rrset", []dns.RR{emptyRR("example.com.", dns.ClassANY, dns.TypeNS)}, zone},
+		{"apex soa value", []dns.RR{mustRR(t, "example.com. 0 NONE SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600")}, zone},
+		{"apex ns value", []dns.RR{mustRR(t, "example.com. 0 NONE NS ns1.example.com.")}, []DNSRecord{
+			zone[0],
+			{"example.com.", "NS", 3600, []string{"ns2.example.com."}},
+			zone[2], zone[3], zone[4],
+		}},
+		{"last apex ns value", []dns.RR{
+			mustRR(t, "example.com. 0 NONE NS ns1.example.com."),
+			mustRR(t, "example.com. 0 NONE NS ns2.example.com."),
+		}, []DNSRecord{
+			zone[0],
+			{"example.com.", "NS", 3600, []string{"ns2.example.com."}},
+			zone[2], zone[3], zone[4],
+		}},
+		{"apex name", []dns.RR{emptyRR("example.com.", dns.ClassANY, dns.TypeANY)}, []DNSRecord{
+			zone[0], zone[1], zone[3], zone[4],
+		}},
+		{"ns below the apex", []dns.RR{
+			mustRR(t, "sub.example.com. 60 IN NS ns.sub.example.com."),
+			emptyRR("sub.example.com.", dns.ClassANY, dns.TypeNS),
+		}, zone},
+	} {
+		got := applyUpdate("example.com.", zone, c.Updates)
+		if !sameRRsets(got, c.Want) {
+			t.Errorf("%s: records %v, want %v", c.Name, sortedRRsets(got), sortedRRsets(c.Want))
+		}
+	}
+	if !sameRRsets(zone, updateZone()) {
+		t.Errorf("applyUpdate changed its input to %v", zone)
+	}
+}
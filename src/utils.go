@@ -1,7 +1,9 @@
 package dnscli
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"reflect"
 	"sort"
@@ -179,3 +181,112 @@ func RR2DNSRecord(rr []dns.RR) []DNSRecord {
 	}
 	return result
 }
+
+// rr2Record converts rr into a record whose value DNSRecord2RR parses back
+// into the same RR, TXT character strings are joined into the text itself.
+func rr2Record(rr dns.RR) DNSRecord {
+	h := rr.Header()
+	data := strings.TrimPrefix(rr.String(), h.String())
+	if v, ok := rr.(*dns.TXT); ok {
+		data = strings.Join(v.Txt, "")
+	}
+	return DNSRecord{Name: h.Name, TTL: int(h.Ttl), Type: dns.TypeToString[h.Rrtype], Datas: []string{data}}
+}
+
+func sameName(l, r string) bool {
+	return strings.EqualFold(fqdn(l), fqdn(r))
+}
+
+func sameRRset(l, r DNSRecord) bool {
+	return sameName(l.Name, r.Name) && strings.EqualFold(l.Type, r.Type)
+}
+
+func copyRecord(record DNSRecord) DNSRecord {
+	datas := make([]string, len(record.Datas))
+	copy(datas, record.Datas)
+	record.Datas = datas
+	return record
+}
+
+func checkRecord(Domain string, record DNSRecord) (DNSRecord, error) {
+	record = copyRecord(record)
+	record.Name = fqdn(record.Name)
+	record.Type = strings.ToUpper(record.Type)
+	if _, ok := dns.StringToType[record.Type]; !ok {
+		return record, fmt.Errorf("unknown record type %s", record.Type)
+	}
+	if !dns.IsSubDomain(fqdn(Domain), record.Name) {
+		return record, fmt.Errorf("record %s not in zone %s", record.Name, fqdn(Domain))
+	}
+	if len(record.Datas) == 0 {
+		return record, errors.New("empty record value")
+	}
+	return record, nil
+}
+
+// DNSRecord2RR parses every value of record, in presentation format, into
+// its own RR. Unquoted TXT values are taken as the text itself.
+func DNSRecord2RR(record DNSRecord) ([]dns.RR, error) {
+	result := make([]dns.RR, 0, len(record.Datas))
+	for _, v := range record.Datas {
+		if strings.EqualFold(record.Type, "TXT") && !strings.HasPrefix(v, "\"") {
+			result = append(result, &dns.TXT{
+				Hdr: dns.RR_Header{Name: fqdn(record.Name), Rrtype: dns.TypeTXT,
+					Class: dns.ClassINET, Ttl: uint32(record.TTL)},
+				Txt: splitTXT(v),
+			})
+			continue
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", fqdn(record.Name), record.TTL, record.Type, v))
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("empty %s record for %s", record.Type, record.Name)
+		}
+		result = append(result, rr)
+	}
+	return result, nil
+}
+
+// splitTXT cuts text into the 255 octets character strings of a TXT RR.
+func splitTXT(text string) []string {
+	result := make([]string, 0, len(text)/255+1)
+	for len(text) > 255 {
+		result = append(result, text[:255])
+		text = text[255:]
+	}
+	return append(result, text)
+}
+
+// groupRRsets merges records of the same name and type, as returned one per
+// value by some providers, into RRsets.
+func groupRRsets(records []DNSRecord) []DNSRecord {
+	result := make([]DNSRecord, 0, len(records))
+	index := make(map[string]int)
+	for _, v := range records {
+		key := strings.ToLower(fqdn(v.Name)) + " " + strings.ToUpper(v.Type)
+		if i, ok := index[key]; ok {
+			result[i].Datas = append(result[i].Datas, v.Datas...)
+			continue
+		}
+		index[key] = len(result)
+		result = append(result, copyRecord(v))
+	}
+	return result
+}
+
+// records2RR converts provider records into RRs, records which can not be
+// parsed are logged and skipped.
+func records2RR(records []DNSRecord) []dns.RR {
+	result := make([]dns.RR, 0, len(records))
+	for _, v := range records {
+		rrs, err := DNSRecord2RR(v)
+		if err != nil {
+			log.Printf("Skip record %s %s, %s", v.Name, v.Type, err)
+			continue
+		}
+		result = append(result, rrs...)
+	}
+	return result
+}
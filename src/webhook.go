@@ -0,0 +1,263 @@
+package dnscli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// webhookMediaType is the content type of the external-dns webhook protocol.
+const webhookMediaType = "application/external.dns.webhook+json;version=1"
+
+// webhookEndpoint is an external-dns endpoint, an RRset whose name has no
+// trailing dot.
+type webhookEndpoint struct {
+	DNSName          string            `json:"dnsName"`
+	Targets          []string          `json:"targets"`
+	RecordType       string            `json:"recordType"`
+	SetIdentifier    string            `json:"setIdentifier,omitempty"`
+	RecordTTL        int64             `json:"recordTTL,omitempty"`
+	Labels           map[string]string `json:"labels,omitempty"`
+	ProviderSpecific []webhookProperty `json:"providerSpecific,omitempty"`
+}
+
+type webhookProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// webhookChanges is the plan external-dns applies, UpdateOld holds the
+// current content of the RRsets replaced by UpdateNew.
+type webhookChanges struct {
+	Create    []*webhookEndpoint
+	UpdateOld []*webhookEndpoint
+	UpdateNew []*webhookEndpoint
+	Delete    []*webhookEndpoint
+}
+
+type webhookDomainFilter struct {
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+func writeWebhook(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", webhookMediaType)
+	w.Header().Set("Vary", "Content-Type")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Write webhook response error, %s", err)
+	}
+}
+
+// endpointRecord returns the RRset of e. TXT targets quoted by external-dns
+// are unquoted, like the records of the other providers.
+func endpointRecord(e *webhookEndpoint) DNSRecord {
+	record := DNSRecord{
+		Name:  fqdn(e.DNSName),
+		Type:  strings.ToUpper(e.RecordType),
+		TTL:   int(e.RecordTTL),
+		Datas: make([]string, 0, len(e.Targets)),
+	}
+	if record.TTL == 0 {
+		record.TTL = 300
+	}
+	for _, v := range e.Targets {
+		if record.Type == "TXT" && strings.HasPrefix(v, "\"") {
+			if text, err := strconv.Unquote(v); err == nil {
+				v = text
+			}
+		}
+		record.Datas = append(record.Datas, v)
+	}
+	return record
+}
+
+func recordEndpoint(record DNSRecord) *webhookEndpoint {
+	return &webhookEndpoint{
+		DNSName:    defqdn(record.Name),
+		Targets:    append([]string{}, record.Datas...),
+		RecordType: record.Type,
+		RecordTTL:  int64(record.TTL),
+	}
+}
+
+// webhookRecords returns the RRsets of every domain but their SOA.
+func (s *Cli) webhookRecords() ([]*webhookEndpoint, error) {
+	zones := make([]string, 0, len(s.dnsProviders))
+	for k := range s.dnsProviders {
+		zones = append(zones, k)
+	}
+	sort.Strings(zones)
+	result := make([]*webhookEndpoint, 0)
+	for _, zone := range zones {
+		records, err := s.dnsProviders[zone].List(zone)
+		if err != nil {
+			return nil, fmt.Errorf("list %s error, %s", zone, err)
+		}
+		for _, v := range groupRRsets(records) {
+			if strings.EqualFold(v.Type, "SOA") {
+				continue
+			}
+			result = append(result, recordEndpoint(v))
+		}
+	}
+	return result, nil
+}
+
+// webhookApply splits the plan by zone and applies each part with
+// applyChanges, zones are applied in order and a failure stops the rest.
+func (s *Cli) webhookApply(r *http.Request, plan webhookChanges) error {
+	changes := make(map[string]*RecordChanges)
+	zones := make([]string, 0)
+	add := func(e *webhookEndpoint, remove bool) error {
+		record := endpointRecord(e)
+		if e.SetIdentifier != "" {
+			return fmt.Errorf("record %s: set identifiers are not supported", record.Name)
+		}
+		zone := s.findDomain(record.Name)
+		if zone == "" {
+			return fmt.Errorf("record %s: domain not found", record.Name)
+		}
+		record, err := checkRecord(zone, record)
+		if err != nil {
+			return err
+		}
+		if _, ok := changes[zone]; !ok {
+			changes[zone] = &RecordChanges{}
+			zones = append(zones, zone)
+		}
+		if remove {
+			changes[zone].Delete = append(changes[zone].Delete, record)
+		} else {
+			changes[zone].Add = append(changes[zone].Add, record)
+		}
+		return nil
+	}
+	for _, v := range plan.Create {
+		if err := add(v, false); err != nil {
+			return err
+		}
+	}
+	for _, v := range plan.UpdateNew {
+		if err := add(v, false); err != nil {
+			return err
+		}
+	}
+	for _, v := range plan.UpdateOld {
+		if err := add(v, true); err != nil {
+			return err
+		}
+	}
+	for _, v := range plan.Delete {
+		if err := add(v, true); err != nil {
+			return err
+		}
+	}
+	s.updateLock.Lock()
+	defer s.updateLock.Unlock()
+	for _, zone := range zones {
+		start := time.Now()
+		result, err := applyChanges(s.dnsProviders[zone], zone, *changes[zone])
+		if s.audit != nil {
+			entry := s.auditChange("webhook", zone, start, result, err)
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				entry.Client = host
+			}
+			s.audit.write(entry)
+		}
+		if err = primaryError(err); err != nil {
+			return fmt.Errorf("apply changes to %s error, %s", zone, err)
+		}
+	}
+	return nil
+}
+
+// serveWebhook implements the external-dns webhook provider protocol: GET /
+// negotiates the domain filter, GET /records lists, POST /records applies a
+// plan and POST /adjustendpoints returns the endpoints as they will be read
+// back.
+func (s *Cli) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && !strings.HasPrefix(r.Header.Get("Content-Type"), "application/external.dns.webhook+json") {
+		writeError(w, http.StatusUnsupportedMediaType, "content type must be %s", webhookMediaType)
+		return
+	}
+	switch {
+	case r.URL.Path == "/" && r.Method == http.MethodGet:
+		filter := webhookDomainFilter{Include: make([]string, 0, len(s.dnsProviders))}
+		for k := range s.dnsProviders {
+			filter.Include = append(filter.Include, defqdn(k))
+		}
+		sort.Strings(filter.Include)
+		writeWebhook(w, http.StatusOK, filter)
+	case r.URL.Path == "/healthz" && r.Method == http.MethodGet:
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/records" && r.Method == http.MethodGet:
+		endpoints, err := s.webhookRecords()
+		if err != nil {
+			log.Printf("Webhook records error, %s", err)
+			writeError(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		writeWebhook(w, http.StatusOK, endpoints)
+	case r.URL.Path == "/records" && r.Method == http.MethodPost:
+		plan := webhookChanges{}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<24))
+		if err == nil {
+			err = json.Unmarshal(body, &plan)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid changes, %s", err)
+			return
+		}
+		if err := s.webhookApply(r, plan); err != nil {
+			log.Printf("Webhook apply error, %s", err)
+			writeError(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/adjustendpoints" && r.Method == http.MethodPost:
+		endpoints := make([]*webhookEndpoint, 0)
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<24))
+		if err == nil {
+			err = json.Unmarshal(body, &endpoints)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid endpoints, %s", err)
+			return
+		}
+		for _, v := range endpoints {
+			v.RecordType = strings.ToUpper(v.RecordType)
+			v.ProviderSpecific = nil
+		}
+		writeWebhook(w, http.StatusOK, endpoints)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// ServeWebhook runs the external-dns webhook provider of `dns webhook` on
+// WebhookListen.
+func (s *Cli) ServeWebhook() {
+	for k, v := range s.dnsProviders {
+		if err := v.Init(); err != nil {
+			log.Fatalf("Init provider for %s error, %s", k, err)
+		}
+	}
+	audit, err := openAuditLog(s.Config.AuditLog)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s.audit = audit
+	server := &http.Server{
+		Addr:    s.Config.WebhookListen,
+		Handler: http.HandlerFunc(s.serveWebhook),
+	}
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,240 @@
+package dnscli
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxZoneVersions is how many versions of a zone are kept for IXFR.
+const maxZoneVersions = 16
+
+type zoneVersion struct {
+	serial uint32
+	rrs    []dns.RR
+}
+
+// zoneHistory numbers the successive contents of every zone seen by the
+// daemon. Providers have no usable serial of their own, so a new serial is
+// made up whenever the content read from the provider changes.
+type zoneHistory struct {
+	lock     sync.Mutex
+	versions map[string][]zoneVersion
+}
+
+func nextSerial(last uint32) uint32 {
+	serial := uint32(time.Now().Unix())
+	if int32(serial-last) <= 0 {
+		serial = last + 1
+	}
+	return serial
+}
+
+// observe records rrs, the content of zone without its SOA, and returns its
+// serial.
+func (s *zoneHistory) observe(zone string, rrs []dns.RR) uint32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.versions == nil {
+		s.versions = make(map[string][]zoneVersion)
+	}
+	versions := s.versions[zone]
+	if n := len(versions); n > 0 {
+		if sameRRs(versions[n-1].rrs, rrs) {
+			return versions[n-1].serial
+		}
+		versions = append(versions, zoneVersion{nextSerial(versions[n-1].serial), rrs})
+	} else {
+		versions = append(versions, zoneVersion{nextSerial(0), rrs})
+	}
+	if len(versions) > maxZoneVersions {
+		versions = versions[len(versions)-maxZoneVersions:]
+	}
+	s.versions[zone] = versions
+	return versions[len(versions)-1].serial
+}
+
+// since returns the versions following serial, oldest first, or false when
+// serial is not known anymore.
+func (s *zoneHistory) since(zone string, serial uint32) ([]zoneVersion, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	versions := s.versions[zone]
+	for i, v := range versions {
+		if v.serial == serial {
+			return append([]zoneVersion{}, versions[i:]...), true
+		}
+	}
+	return nil, false
+}
+
+// zoneSOA returns the SOA served for zone. The one of the provider is used
+// when there is one, otherwise it is made up from the zone NS records. The
+// serial is always the one of the zone history.
+func zoneSOA(zone string, rrs []dns.RR, serial uint32) *dns.SOA {
+	soa := &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+		Ns:      "ns." + zone,
+		Mbox:    "hostmaster." + zone,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  604800,
+		Minttl:  300,
+	}
+	for _, v := range rrs {
+		if !sameName(v.Header().Name, zone) {
+			continue
+		}
+		if v, ok := v.(*dns.NS); ok && soa.Ns == "ns."+zone {
+			soa.Ns = v.Ns
+		}
+		if v, ok := v.(*dns.SOA); ok {
+			soa = dns.Copy(v).(*dns.SOA)
+			break
+		}
+	}
+	soa.Hdr.Name = zone
+	soa.Serial = serial
+	return soa
+}
+
+// withoutSOA drops the SOA records, zoneSOA makes the served one.
+func withoutSOA(rrs []dns.RR) []dns.RR {
+	result := make([]dns.RR, 0, len(rrs))
+	for _, v := range rrs {
+		if v.Header().Rrtype != dns.TypeSOA {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// zoneContent lists zone from its provider and returns its RRs, without
+// SOA, with the SOA to serve.
+func (s *Cli) zoneContent(zone string) ([]dns.RR, *dns.SOA, error) {
+	records, err := s.cache.list(zone, s.dnsProviders[zone])
+	if err != nil {
+		return nil, nil, err
+	}
+	all := records2RR(records)
+	rrs := withoutSOA(all)
+	serial := s.history.observe(zone, rrs)
+	return rrs, zoneSOA(zone, all, serial), nil
+}
+
+// diffRRs returns the RRs of l missing in r.
+func diffRRs(l, r []dns.RR) []dns.RR {
+	result := make([]dns.RR, 0)
+	for _, v := range l {
+		if !containsRR(r, v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ixfrAnswer builds an incremental transfer from versions, RFC 1995 §4.
+func ixfrAnswer(soa *dns.SOA, versions []zoneVersion) []dns.RR {
+	result := []dns.RR{soa}
+	for i := 1; i < len(versions); i++ {
+		from, to := versions[i-1], versions[i]
+		fromSOA := dns.Copy(soa).(*dns.SOA)
+		fromSOA.Serial = from.serial
+		toSOA := dns.Copy(soa).(*dns.SOA)
+		toSOA.Serial = to.serial
+		result = append(result, fromSOA)
+		result = append(result, diffRRs(from.rrs, to.rrs)...)
+		result = append(result, toSOA)
+		result = append(result, diffRRs(to.rrs, from.rrs)...)
+	}
+	return append(result, soa)
+}
+
+// writeTransfer sends rrs in as many messages as needed.
+func writeTransfer(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) error {
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- tr.Out(w, r, ch)
+	}()
+	// Out stops reading on the first write error, so sending must stop too.
+	send := func(e *dns.Envelope) error {
+		select {
+		case ch <- e:
+			return nil
+		case err := <-errc:
+			if err == nil {
+				err = errors.New("transfer ended early")
+			}
+			return err
+		}
+	}
+	chunk := make([]dns.RR, 0)
+	size := 0
+	for _, v := range rrs {
+		if l := dns.Len(v); size+l > dns.MaxMsgSize-1024 && len(chunk) > 0 {
+			if err := send(&dns.Envelope{RR: chunk}); err != nil {
+				return err
+			}
+			chunk, size = make([]dns.RR, 0), 0
+		}
+		chunk = append(chunk, v)
+		size += dns.Len(v)
+	}
+	if err := send(&dns.Envelope{RR: chunk}); err != nil {
+		return err
+	}
+	close(ch)
+	return <-errc
+}
+
+// handleTransfer answers AXFR and IXFR requests, RFC 5936 and RFC 1995. It
+// writes the response itself.
+func (s *Cli) handleTransfer(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, key *TsigKey) bool {
+	q := r.Question[0]
+	zone := s.findZone(q.Name)
+	// A transfer hands out every name and type of the zone.
+	if zone == "" || !key.Query || !key.allowZone(zone) || len(key.Names) > 0 || len(key.Types) > 0 {
+		m.SetRcode(r, dns.RcodeRefused)
+		return false
+	}
+	rrs, soa, err := s.zoneContent(zone)
+	if err != nil {
+		log.Print(err)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return false
+	}
+	// Only TCP, with or without TLS, carries the stream of a transfer.
+	stream := w.RemoteAddr().Network() == "tcp"
+	if q.Qtype == dns.TypeAXFR && !stream {
+		m.SetRcode(r, dns.RcodeFormatError)
+		return false
+	}
+	answer := append(append([]dns.RR{soa}, rrs...), soa)
+	if q.Qtype == dns.TypeIXFR {
+		var serial uint32
+		for _, v := range r.Ns {
+			if v, ok := v.(*dns.SOA); ok {
+				serial = v.Serial
+			}
+		}
+		if int32(serial-soa.Serial) >= 0 || !stream {
+			// Up to date, or asked over UDP where the client retries with
+			// TCP once it sees a newer SOA, RFC 1995 §2.
+			m.Authoritative = true
+			m.Answer = []dns.RR{soa}
+			return false
+		}
+		if versions, ok := s.history.since(zone, serial); ok {
+			answer = ixfrAnswer(soa, versions)
+		}
+	}
+	if err := writeTransfer(w, r, answer); err != nil {
+		log.Printf("Transfer of %s failed, %s", zone, err)
+	}
+	return true
+}